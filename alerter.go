@@ -1,14 +1,29 @@
 package accessmon
 
 import (
+	"sync"
 	"time"
 )
 
+// Metrics watched by the Alerters
+const (
+	MetricRequestRate = "request_rate" // total requests per second
+	MetricLatency     = "latency"      // p95 response time in seconds
+	MetricErrorRate   = "error_rate"   // percentage of responses in the error status code class
+)
+
 // Alert represents an alert generated by the Alerter
 type Alert struct {
-	Start time.Time
-	End   time.Time
-	Value float64
+	Rule     string // name of the rule that triggered the alert
+	Severity string // severity of the rule that triggered the alert
+	Metric   string // metric that triggered the alert
+	Section  string // section that triggered the alert ( per section rules only )
+	Baseline bool   // Value is a deviation from the learned baseline in standard deviations
+	Start    time.Time
+	End      time.Time
+	Value    float64
+
+	Percentile float64 // latency percentile watched ( latency alerts only )
 }
 
 // IsOngoing returns true if the alert has a start but no end
@@ -17,10 +32,22 @@ func (alert *Alert) IsOngoing() bool {
 }
 
 // Alerter provides sliding window threshold based anomaly detection
-// /!\ NOT THREAD SAFE /!\
+// It is safe for concurrent use, the returned alerts are copies
 type Alerter struct {
-	window    time.Duration // the sliding window size
-	threshold float64       // the threshold to reach
+	lock sync.Mutex
+
+	rule      string        // the rule name
+	severity  string        // the rule severity
+	metric    string        // the metric watched
+	section   string        // the section watched ( per section rules only )
+	baseline  bool          // the values are deviations from a learned baseline
+	window    time.Duration // the sliding window size to raise an alert
+	threshold float64       // the threshold to reach to raise an alert
+
+	clearWindow    time.Duration // the sliding window size to clear an alert
+	clearThreshold float64       // the threshold to go under to clear an alert
+
+	percentile float64 // the latency percentile watched ( latency rules only )
 
 	mark    time.Time // keep track of the last status change
 	ongoing *Alert    // keep track of the current alert if any
@@ -28,30 +55,78 @@ type Alerter struct {
 	alerts []*Alert // keep track of all issued alerts ( legacy )
 }
 
-// NewAlerter builds a new Alerter with the given sliding window and threshold
+// NewAlerter builds a new request rate Alerter with the given sliding window and threshold
 func NewAlerter(window time.Duration, threshold float64) (alerter *Alerter) {
-	return &Alerter{window: window, threshold: threshold}
+	return NewMetricAlerter(MetricRequestRate, window, threshold)
+}
+
+// NewRuleAlerter builds a new Alerter from the rule parameters
+func NewRuleAlerter(rule *Rule) (alerter *Alerter) {
+	alerter = NewMetricAlerter(rule.Metric, rule.Window, rule.Threshold)
+	alerter.SetClear(rule.ClearWindow, rule.ClearThreshold)
+	alerter.rule = rule.Name
+	alerter.severity = rule.Severity
+	alerter.baseline = rule.Baseline != nil
+	if rule.Metric == MetricLatency {
+		alerter.percentile = rule.Percentile
+	}
+	return alerter
+}
+
+// NewSectionAlerter builds a new Alerter from the rule parameters for a single section
+func NewSectionAlerter(rule *Rule, section string) (alerter *Alerter) {
+	alerter = NewRuleAlerter(rule)
+	alerter.section = section
+	return alerter
+}
+
+// NewMetricAlerter builds a new Alerter for the given metric with the given sliding window and threshold
+func NewMetricAlerter(metric string, window time.Duration, threshold float64) (alerter *Alerter) {
+	return &Alerter{metric: metric, window: window, threshold: threshold, clearWindow: window, clearThreshold: threshold}
+}
+
+// SetClear sets the sliding window and the threshold used to clear an ongoing alert
+// A clear threshold lower than the raise threshold prevents values hovering around it from flapping
+// Zero values keep the raise parameters
+func (a *Alerter) SetClear(window time.Duration, threshold float64) {
+	a.clearWindow = a.window
+	if window > 0 {
+		a.clearWindow = window
+	}
+	a.clearThreshold = a.threshold
+	if threshold > 0 {
+		a.clearThreshold = threshold
+	}
 }
 
 // Check the current and update the Alerter internal state machine
 // If the value did trigger the start or end of an alert it is returned
 // ! Check assumes that the provided value holds for the last continuous period since the last call
 func (a *Alerter) Check(now time.Time, value float64) (alert *Alert) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
 	if a.mark.IsZero() {
 		// The first message needs to initialize the mark
 		a.mark = now
 	}
-	if value >= a.threshold {
+	// An ongoing alert stays abnormal until the value goes under the clear threshold
+	threshold := a.threshold
+	if a.ongoing != nil {
+		threshold = a.clearThreshold
+	}
+	if value >= threshold {
 		if a.ongoing == nil {
 			deadline := a.mark.Add(a.window)
 			if now.After(deadline) || now.Equal(deadline) {
 				// all the parameters to create a new alert are present
 				// we have only received abnormal values since at least full window duration
-				a.ongoing = &Alert{Start: now, Value: value}
+				a.ongoing = &Alert{Rule: a.rule, Severity: a.severity, Metric: a.metric, Section: a.section, Baseline: a.baseline, Start: now, Value: value, Percentile: a.percentile}
 				a.alerts = append(a.alerts, a.ongoing)
 
 				// Return alert
-				alert = a.ongoing
+				copied := *a.ongoing
+				alert = &copied
 
 				// Update mark
 				a.mark = now
@@ -67,14 +142,15 @@ func (a *Alerter) Check(now time.Time, value float64) (alert *Alert) {
 		}
 	} else {
 		if a.ongoing != nil {
-			deadline := a.mark.Add(a.window)
+			deadline := a.mark.Add(a.clearWindow)
 			if now.After(deadline) || now.Equal(deadline) {
 				// all the parameters to close the ongoing alert are present
 				// we have only received only normal values since at least full window duration
 				a.ongoing.End = now
 
 				// Return alert
-				alert = a.ongoing
+				copied := *a.ongoing
+				alert = &copied
 
 				// Reset ongoing and update mark
 				a.ongoing = nil
@@ -96,7 +172,22 @@ func (a *Alerter) Check(now time.Time, value float64) (alert *Alert) {
 	return alert
 }
 
-// Alerts returns all alerts previously issued by the Alerter
+// IsOngoing returns true if the Alerter has an ongoing alert
+func (a *Alerter) IsOngoing() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.ongoing != nil
+}
+
+// Alerts returns a copy of all alerts previously issued by the Alerter
 func (a *Alerter) Alerts() (alerts []*Alert) {
-	return a.alerts
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, alert := range a.alerts {
+		copied := *alert
+		alerts = append(alerts, &copied)
+	}
+	return alerts
 }
@@ -2,6 +2,7 @@ package accessmon
 
 import (
 	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
 	"time"
 )
@@ -138,3 +139,93 @@ func TestNewAlerter_CheckIrregularWindow(t *testing.T) {
 	require.Equal(t, start.Add(55*time.Second), a.alerts[1].Start)
 	require.True(t, a.alerts[1].IsOngoing())
 }
+
+func TestNewAlerter_CheckHysteresis(t *testing.T) {
+	tests := []struct {
+		name           string
+		clearWindow    time.Duration
+		clearThreshold float64
+		values         []float64
+		starts         []int // start second of each alert
+		ends           []int // end second of each alert, -1 if ongoing
+	}{
+		{
+			name:   "hovering without hysteresis",
+			values: []float64{0, 12, 12, 12, 9, 9, 9, 12, 12, 12, 9, 9, 9},
+			starts: []int{2, 8},
+			ends:   []int{5, 11},
+		},
+		{
+			name:           "hovering with hysteresis",
+			clearThreshold: 8,
+			values:         []float64{0, 12, 12, 12, 9, 9, 9, 12, 12, 12, 9, 9, 9},
+			starts:         []int{2},
+			ends:           []int{-1},
+		},
+		{
+			name:           "clear under the clear threshold",
+			clearThreshold: 8,
+			values:         []float64{0, 12, 12, 12, 9, 7, 7, 7, 7},
+			starts:         []int{2},
+			ends:           []int{6},
+		},
+		{
+			name:        "clear window longer than raise window",
+			clearWindow: 5 * time.Second,
+			values:      []float64{0, 50, 50, 50, 0, 0, 0, 0, 0, 0},
+			starts:      []int{2},
+			ends:        []int{8},
+		},
+		{
+			name:        "clear window shorter than raise window",
+			clearWindow: time.Second,
+			values:      []float64{0, 50, 50, 50, 0, 0, 0},
+			starts:      []int{2},
+			ends:        []int{4},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NewAlerter(2*time.Second, float64(10))
+			a.SetClear(test.clearWindow, test.clearThreshold)
+			a.playFixedInterval(start, time.Second, test.values)
+
+			require.Len(t, a.Alerts(), len(test.starts))
+			for i, alert := range a.Alerts() {
+				require.Equal(t, start.Add(time.Duration(test.starts[i])*time.Second), alert.Start)
+				if test.ends[i] < 0 {
+					require.True(t, alert.IsOngoing())
+				} else {
+					require.Equal(t, start.Add(time.Duration(test.ends[i])*time.Second), alert.End)
+				}
+			}
+		})
+	}
+}
+
+func TestNewAlerter_CheckConcurrent(t *testing.T) {
+	a := NewAlerter(time.Second, float64(10))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			value := float64(50)
+			if i%10 >= 5 {
+				value = 0
+			}
+			a.Check(start.Add(time.Duration(i)*time.Second), value)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		for _, alert := range a.Alerts() {
+			require.False(t, alert.Start.IsZero())
+		}
+		_ = a.IsOngoing()
+	}
+	wg.Wait()
+
+	require.Len(t, a.Alerts(), 100)
+}
@@ -0,0 +1,198 @@
+package accessmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// API serves the live statistics and alerts of a Monitor as JSON
+// GET /api/stats?window=1m&top=10
+// GET /api/alerts?ongoing=true
+// GET /api/health
+type API struct {
+	mon  *Monitor
+	mux  *http.ServeMux
+	host string
+}
+
+// Default and maximum API parameters
+const (
+	defaultAPIWindow = time.Minute
+	defaultAPITop    = 10
+	maxAPITop        = 1000
+)
+
+// StatsResponse is the JSON representation of Stats
+type StatsResponse struct {
+	Time               time.Time `json:"time"`   // time of the last request processed
+	Window             float64   `json:"window"` // in seconds
+	Count              int       `json:"count"`
+	RequestRate        float64   `json:"request_rate"`
+	ServerErrorPercent float64   `json:"server_error_percent"`
+	HTTP2Percent       float64   `json:"http2_percent"`
+	IPv6Percent        float64   `json:"ipv6_percent"`
+
+	StatusClasses map[string]int `json:"status_classes"` // number of requests by status code class ( "2xx" )
+
+	Latency *LatencyResponse `json:"latency,omitempty"`
+
+	TopSections []*TopResponse `json:"top_sections"`
+	TopUsers    []*TopResponse `json:"top_users"`
+	TopSources  []*TopResponse `json:"top_sources"`
+}
+
+// LatencyResponse is the JSON representation of Latency in milliseconds
+type LatencyResponse struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// TopResponse is the JSON representation of a top N entry
+type TopResponse struct {
+	Key         string           `json:"key"`
+	Count       int              `json:"count"`
+	RequestRate float64          `json:"request_rate"`
+	Latency     *LatencyResponse `json:"latency,omitempty"` // top sections only
+}
+
+// HealthResponse is the JSON representation of the Monitor health
+type HealthResponse struct {
+	Status string    `json:"status"`
+	Last   time.Time `json:"last"` // time of the last request processed
+	Lines  int       `json:"lines"`
+	Errors int       `json:"errors"`
+}
+
+// NewAPI builds the API handler of the Monitor
+func NewAPI(mon *Monitor) (api *API) {
+	api = &API{mon: mon, mux: http.NewServeMux(), host: hostname()}
+	api.mux.HandleFunc("/api/stats", api.stats)
+	api.mux.HandleFunc("/api/alerts", api.alerts)
+	api.mux.HandleFunc("/api/health", api.health)
+	return api
+}
+
+// ServeHTTP routes the API requests
+func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mux.ServeHTTP(w, r)
+}
+
+func (api *API) stats(w http.ResponseWriter, r *http.Request) {
+	window := defaultAPIWindow
+	if value := r.URL.Query().Get("window"); value != "" {
+		var err error
+		window, err = time.ParseDuration(value)
+		if err != nil || window <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid window")
+			return
+		}
+	}
+	if max := api.mon.StoreWindow(); window > max {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("window larger than the %s stored window", max))
+		return
+	}
+
+	top := defaultAPITop
+	if value := r.URL.Query().Get("top"); value != "" {
+		var err error
+		top, err = strconv.Atoi(value)
+		if err != nil || top < 0 || top > maxAPITop {
+			writeError(w, http.StatusBadRequest, "invalid top")
+			return
+		}
+	}
+
+	writeJSON(w, NewStatsResponse(api.mon.Stats(window, top), api.mon.Last(), window))
+}
+
+func (api *API) alerts(w http.ResponseWriter, r *http.Request) {
+	ongoing := r.URL.Query().Get("ongoing") == "true"
+
+	events := []*AlertEvent{}
+	for _, alert := range api.mon.Alerts() {
+		if ongoing && !alert.IsOngoing() {
+			continue
+		}
+		events = append(events, NewAlertEvent(alert, api.host))
+	}
+
+	writeJSON(w, events)
+}
+
+func (api *API) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, &HealthResponse{
+		Status: "ok",
+		Last:   api.mon.Last(),
+		Lines:  api.mon.Lines(),
+		Errors: api.mon.Errors(),
+	})
+}
+
+// NewStatsResponse builds the JSON representation of the stats
+func NewStatsResponse(stats *Stats, now time.Time, window time.Duration) (resp *StatsResponse) {
+	resp = &StatsResponse{
+		Time:          now,
+		Window:        window.Seconds(),
+		Count:         stats.Count,
+		RequestRate:   perSecond(stats.Count, window),
+		StatusClasses: make(map[string]int),
+		Latency:       newLatencyResponse(stats.Latency),
+		TopSections:   newTopResponse(stats.TopSection, window),
+		TopUsers:      newTopResponse(stats.TopUsers, window),
+		TopSources:    newTopResponse(stats.TopSources, window),
+	}
+	for class, count := range stats.StatusClasses {
+		resp.StatusClasses[fmt.Sprintf("%dxx", class)] = count
+	}
+
+	// Percentages are NaN without requests
+	if stats.Count > 0 {
+		resp.ServerErrorPercent = stats.ServerError
+		resp.HTTP2Percent = stats.HTTP2
+		resp.IPv6Percent = stats.Ipv6
+	}
+
+	for _, section := range resp.TopSections {
+		section.Latency = newLatencyResponse(stats.SectionLatency[section.Key])
+	}
+
+	return resp
+}
+
+func newLatencyResponse(latency *Latency) *LatencyResponse {
+	if latency == nil {
+		return nil
+	}
+	return &LatencyResponse{
+		Count: latency.Count,
+		P50:   milliseconds(latency.P50),
+		P90:   milliseconds(latency.P90),
+		P99:   milliseconds(latency.P99),
+		Max:   milliseconds(latency.Max),
+	}
+}
+
+func newTopResponse(values []*CounterValue, window time.Duration) (top []*TopResponse) {
+	top = []*TopResponse{}
+	for _, value := range values {
+		top = append(top, &TopResponse{Key: value.Key, Count: value.Count, RequestRate: perSecond(value.Count, window)})
+	}
+	return top
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
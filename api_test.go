@@ -0,0 +1,127 @@
+package accessmon
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func apiGet(t *testing.T, api *API, url string, status int, value interface{}) {
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	require.Equal(t, status, recorder.Code, recorder.Body.String())
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	if value != nil {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), value))
+	}
+}
+
+func apiMonitor(t *testing.T) *Monitor {
+	mon, err := NewMonitor(&Config{StoreWindow: time.Minute, AlertWindow: 2 * time.Second, AlertThreshold: 1})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		for _, path := range []string{"/api/user", "/api/user", "/www"} {
+			req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: path, HTTPVersion: "HTTP/1.1", Code: 200}
+			_, err := mon.AddLine(req.String())
+			require.NoError(t, err)
+		}
+	}
+	_, _ = mon.AddLine("invalid")
+	return mon
+}
+
+func TestAPI_Stats(t *testing.T) {
+	api := NewAPI(apiMonitor(t))
+
+	stats := &StatsResponse{}
+	apiGet(t, api, "/api/stats?window=10s&top=1", http.StatusOK, stats)
+	require.True(t, start.Add(9*time.Second).Equal(stats.Time))
+	require.Equal(t, float64(10), stats.Window)
+	require.Equal(t, 30, stats.Count)
+	require.Equal(t, float64(3), stats.RequestRate)
+	require.Len(t, stats.TopSections, 1)
+	require.Equal(t, "/api", stats.TopSections[0].Key)
+	require.Equal(t, 20, stats.TopSections[0].Count)
+	require.Equal(t, map[string]int{"2xx": 30}, stats.StatusClasses)
+	require.Equal(t, "mary", stats.TopUsers[0].Key)
+	require.Nil(t, stats.Latency)
+
+	// Default window and top
+
+	stats = &StatsResponse{}
+	apiGet(t, api, "/api/stats", http.StatusOK, stats)
+	require.Equal(t, float64(60), stats.Window)
+	require.Equal(t, 30, stats.Count)
+	require.Len(t, stats.TopSections, 2)
+
+	apiGet(t, api, "/api/stats?window=invalid", http.StatusBadRequest, nil)
+	apiGet(t, api, "/api/stats?window=-1s", http.StatusBadRequest, nil)
+	apiGet(t, api, "/api/stats?window=1h", http.StatusBadRequest, nil)
+	apiGet(t, api, "/api/stats?top=invalid", http.StatusBadRequest, nil)
+}
+
+func TestAPI_StatsEmpty(t *testing.T) {
+	mon, err := NewMonitor(&Config{StoreWindow: time.Minute})
+	require.NoError(t, err)
+	api := NewAPI(mon)
+
+	stats := &StatsResponse{}
+	apiGet(t, api, "/api/stats", http.StatusOK, stats)
+	require.Equal(t, 0, stats.Count)
+	require.Equal(t, float64(0), stats.ServerErrorPercent)
+	require.Len(t, stats.TopSections, 0)
+}
+
+func TestAPI_Alerts(t *testing.T) {
+	api := NewAPI(apiMonitor(t))
+
+	var events []*AlertEvent
+	apiGet(t, api, "/api/alerts", http.StatusOK, &events)
+	require.Len(t, events, 1)
+	require.Equal(t, "high_traffic", events[0].Rule)
+	require.Equal(t, AlertStatusOpen, events[0].Status)
+
+	events = nil
+	apiGet(t, api, "/api/alerts?ongoing=true", http.StatusOK, &events)
+	require.Len(t, events, 1)
+}
+
+func TestAPI_Health(t *testing.T) {
+	api := NewAPI(apiMonitor(t))
+
+	health := &HealthResponse{}
+	apiGet(t, api, "/api/health", http.StatusOK, health)
+	require.Equal(t, "ok", health.Status)
+	require.Equal(t, 31, health.Lines)
+	require.Equal(t, 1, health.Errors)
+}
+
+func TestAPI_Concurrent(t *testing.T) {
+	mon, err := NewMonitor(&Config{StoreWindow: time.Minute, AlertWindow: time.Second, AlertThreshold: 1})
+	require.NoError(t, err)
+	api := NewAPI(mon)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * 100 * time.Millisecond), Method: "GET", Path: "/api", HTTPVersion: "HTTP/1.1", Code: 200}
+			_, _ = mon.AddLine(req.String())
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		apiGet(t, api, "/api/stats?window=10s", http.StatusOK, nil)
+		apiGet(t, api, "/api/alerts", http.StatusOK, nil)
+		apiGet(t, api, "/api/health", http.StatusOK, nil)
+	}
+
+	wg.Wait()
+}
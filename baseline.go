@@ -0,0 +1,121 @@
+package accessmon
+
+import (
+	"math"
+	"time"
+)
+
+// BaselineConfig holds the parameters of an adaptive Baseline
+type BaselineConfig struct {
+	Alpha    float64 `yaml:"alpha"`    // EWMA smoothing factor in ]0,1] ( 0.05 by default )
+	Seasonal bool    `yaml:"seasonal"` // learn a distinct baseline for each hour of the week
+	Warmup   int     `yaml:"warmup"`   // number of samples to learn before reporting deviations ( 10 by default )
+}
+
+// Default BaselineConfig parameters
+const (
+	defaultBaselineAlpha  = 0.05
+	defaultBaselineWarmup = 10
+)
+
+// baselineOutlier is the number of standard deviations outliers are clamped to before being learned
+const baselineOutlier = 3
+
+// Baseline learns the exponentially weighted moving average and variance of a metric
+// and reports how many standard deviations away from it the current value is
+// /!\ NOT THREAD SAFE /!\
+type Baseline struct {
+	alpha    float64
+	seasonal bool
+	warmup   int
+	interval time.Duration // minimum time between two samples
+
+	buckets map[int]*ewma // one bucket or one per hour of the week
+	last    time.Time     // time of the last sample
+}
+
+// ewma holds the exponentially weighted moving average and variance of a series
+type ewma struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// NewBaseline builds a Baseline sampling the metric at most once per interval
+// so that the learned baseline does not depend on the rate of the Deviation calls
+func NewBaseline(config *BaselineConfig, interval time.Duration) (baseline *Baseline) {
+	baseline = &Baseline{
+		alpha:    config.Alpha,
+		seasonal: config.Seasonal,
+		warmup:   config.Warmup,
+		interval: interval,
+		buckets:  make(map[int]*ewma),
+	}
+	if baseline.alpha <= 0 || baseline.alpha > 1 {
+		baseline.alpha = defaultBaselineAlpha
+	}
+	if baseline.warmup <= 0 {
+		baseline.warmup = defaultBaselineWarmup
+	}
+	return baseline
+}
+
+// Deviation returns the number of standard deviations between the value and the learned baseline
+// and learns the value if the sampling interval has elapsed. It returns 0 during the warmup
+func (baseline *Baseline) Deviation(now time.Time, value float64) (deviation float64) {
+	bucket := baseline.bucket(now)
+
+	var stddev float64
+	if bucket.samples >= baseline.warmup {
+		// A perfectly flat history would make any change infinitely abnormal
+		stddev = math.Max(math.Sqrt(bucket.variance), math.Abs(bucket.mean)*0.01)
+		if stddev > 0 {
+			deviation = (value - bucket.mean) / stddev
+		}
+	}
+
+	// Learn
+
+	if baseline.last.IsZero() || now.Sub(baseline.last) >= baseline.interval {
+		// Outliers are clamped so that an anomaly doesn't become the new normal too fast
+		if stddev > 0 {
+			value = math.Max(math.Min(value, bucket.mean+baselineOutlier*stddev), bucket.mean-baselineOutlier*stddev)
+		}
+		bucket.add(value, baseline.alpha)
+		baseline.last = now
+	}
+
+	return deviation
+}
+
+// Expected returns the learned baseline value at the given time
+func (baseline *Baseline) Expected(now time.Time) float64 {
+	return baseline.bucket(now).mean
+}
+
+// bucket returns the ewma to use at the given time
+func (baseline *Baseline) bucket(now time.Time) *ewma {
+	key := 0
+	if baseline.seasonal {
+		key = int(now.Weekday())*24 + now.Hour()
+	}
+	bucket, ok := baseline.buckets[key]
+	if !ok {
+		bucket = &ewma{}
+		baseline.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// add updates the moving average and variance with a new sample
+func (e *ewma) add(value float64, alpha float64) {
+	if e.samples == 0 {
+		e.mean = value
+	} else {
+		diff := value - e.mean
+		increment := alpha * diff
+		e.mean += increment
+		e.variance = (1 - alpha) * (e.variance + diff*increment)
+	}
+	e.samples++
+}
@@ -0,0 +1,67 @@
+package accessmon
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBaseline_Deviation(t *testing.T) {
+	baseline := NewBaseline(&BaselineConfig{Alpha: 0.1, Warmup: 5}, time.Minute)
+
+	// Warmup
+
+	now := start
+	for i := 0; i < 5; i++ {
+		require.Equal(t, float64(0), baseline.Deviation(now, float64(10+i%2)))
+		now = now.Add(time.Minute)
+	}
+
+	// Learn a 10-11 req/s baseline
+
+	for i := 0; i < 50; i++ {
+		require.InDelta(t, 0, baseline.Deviation(now, float64(10+i%2)), 3)
+		now = now.Add(time.Minute)
+	}
+	require.InDelta(t, 10.5, baseline.Expected(now), 0.5)
+
+	// Spike
+
+	require.True(t, baseline.Deviation(now, 50) > 10)
+}
+
+func TestBaseline_DeviationInterval(t *testing.T) {
+	baseline := NewBaseline(&BaselineConfig{Warmup: 1}, time.Minute)
+
+	baseline.Deviation(start, 10)
+
+	// Samples inside the interval are not learned
+
+	baseline.Deviation(start.Add(time.Second), 1000)
+	require.Equal(t, float64(10), baseline.Expected(start))
+
+	baseline.Deviation(start.Add(time.Minute), 20)
+	require.True(t, baseline.Expected(start) > 10)
+}
+
+func TestBaseline_DeviationSeasonal(t *testing.T) {
+	baseline := NewBaseline(&BaselineConfig{Seasonal: true, Warmup: 1}, time.Minute)
+
+	// Busy at 10 am, quiet at 3 am
+
+	day := time.Date(2019, time.May, 3, 0, 0, 0, 0, time.UTC)
+	for week := 0; week < 3; week++ {
+		now := day.AddDate(0, 0, 7*week)
+		baseline.Deviation(now.Add(3*time.Hour), 1)
+		baseline.Deviation(now.Add(10*time.Hour), 100)
+	}
+
+	require.Equal(t, float64(100), baseline.Expected(day.Add(10*time.Hour)))
+	require.Equal(t, float64(1), baseline.Expected(day.Add(3*time.Hour)))
+
+	// 100 req/s is normal at 10 am but not at 3 am
+
+	next := day.AddDate(0, 0, 21)
+	require.True(t, baseline.Deviation(next.Add(3*time.Hour), 100) > 10)
+	require.Equal(t, float64(0), baseline.Deviation(next.Add(10*time.Hour), 100))
+}
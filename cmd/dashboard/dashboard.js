@@ -0,0 +1,270 @@
+// accessmon dashboard
+// The page loads the current stats and alerts from the JSON API then follows /api/stream
+// The values read from the logs are untrusted, they are only inserted as text nodes
+
+(function () {
+  "use strict";
+
+  var historySize = 360; // number of stats events kept for the chart
+  var history = [];      // { time: Date, rate: Number }
+  var alerts = {};       // alert events by rule, section and start
+
+  // DOM helpers
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function el(tag, className, children) {
+    var node = document.createElement(tag);
+    if (className) {
+      node.className = className;
+    }
+    (children || []).forEach(function (child) {
+      node.appendChild(typeof child === "string" ? document.createTextNode(child) : child);
+    });
+    return node;
+  }
+
+  function row(cells, className) {
+    return el("tr", className, cells.map(function (cell) {
+      if (cell instanceof Node) {
+        return el("td", null, [cell]);
+      }
+      return el("td", typeof cell === "number" ? "number" : "key", [format(cell)]);
+    }));
+  }
+
+  function header(names) {
+    return el("tr", null, names.map(function (name, i) {
+      return el("th", i > 0 ? "number" : null, [name]);
+    }));
+  }
+
+  function fill(table, head, rows, empty) {
+    table.textContent = "";
+    table.appendChild(head);
+    if (rows.length === 0) {
+      table.appendChild(el("tr", null, [el("td", "empty", [empty || "no data"])]));
+    }
+    rows.forEach(function (r) {
+      table.appendChild(r);
+    });
+  }
+
+  function format(value) {
+    if (typeof value === "number") {
+      return Number.isInteger(value) ? String(value) : value.toFixed(2);
+    }
+    return value === undefined || value === null ? "" : String(value);
+  }
+
+  function formatTime(value) {
+    var date = new Date(value);
+    return isNaN(date) || date.getFullYear() < 2 ? "-" : date.toLocaleString();
+  }
+
+  function formatDuration(seconds) {
+    if (seconds < 60) {
+      return seconds.toFixed(0) + "s";
+    }
+    if (seconds < 3600) {
+      return (seconds / 60).toFixed(1) + "m";
+    }
+    return (seconds / 3600).toFixed(1) + "h";
+  }
+
+  // Stats
+
+  function renderStats(stats) {
+    $("window").textContent = "( last " + formatDuration(stats.window) + " )";
+    $("last").textContent = "last request : " + formatTime(stats.time);
+
+    var summary = $("summary");
+    summary.textContent = "";
+    [
+      ["req/s", stats.request_rate],
+      ["requests", stats.count],
+      ["server errors %", stats.server_error_percent],
+      ["HTTP2 %", stats.http2_percent],
+      ["IPv6 %", stats.ipv6_percent]
+    ].forEach(function (item) {
+      summary.appendChild(el("span", null, [el("b", null, [format(item[1])]), " " + item[0]]));
+    });
+
+    renderClasses(stats);
+    renderLatency(stats);
+
+    var top = function (values) {
+      return values.map(function (value) {
+        return row([value.key, value.count, value.request_rate]);
+      });
+    };
+    fill($("sections"), header(["section", "count", "req/s", "p50 ms", "p99 ms"]), stats.top_sections.map(function (section) {
+      var latency = section.latency || {};
+      return row([section.key, section.count, section.request_rate, latency.p50, latency.p99]);
+    }));
+    fill($("users"), header(["user", "count", "req/s"]), top(stats.top_users));
+    fill($("sources"), header(["source", "count", "req/s"]), top(stats.top_sources));
+  }
+
+  function renderClasses(stats) {
+    var classes = Object.keys(stats.status_classes || {}).sort();
+    var bar = $("classes-bar");
+    bar.textContent = "";
+    var rows = classes.map(function (name) {
+      var count = stats.status_classes[name];
+      var percent = stats.count > 0 ? count * 100 / stats.count : 0;
+      var part = el("div", "class-" + name);
+      part.style.width = percent + "%";
+      part.title = name + " " + percent.toFixed(1) + "%";
+      bar.appendChild(part);
+      return row([el("span", null, [el("span", "swatch class-" + name), name]), count, percent]);
+    });
+    fill($("classes"), header(["class", "count", "%"]), rows);
+  }
+
+  function renderLatency(stats) {
+    var latency = stats.latency;
+    var rows = latency ? [row(["ms", latency.p50, latency.p90, latency.p99, latency.max])] : [];
+    fill($("latency"), header(["", "p50", "p90", "p99", "max"]), rows, "the log format provides no request duration");
+  }
+
+  // Chart
+
+  function addPoint(stats) {
+    var time = new Date(stats.time);
+    if (history.length > 0 && time <= history[history.length - 1].time) {
+      return;
+    }
+    history.push({ time: time, rate: stats.request_rate });
+    if (history.length > historySize) {
+      history.shift();
+    }
+  }
+
+  function renderChart() {
+    var chart = $("chart");
+    chart.textContent = "";
+    if (history.length === 0) {
+      return;
+    }
+
+    var from = history[0].time.getTime();
+    var to = history[history.length - 1].time.getTime();
+    var span = Math.max(to - from, 1);
+    var max = Math.max.apply(null, history.map(function (point) { return point.rate; })) || 1;
+    var x = function (time) { return (time - from) * 1000 / span; };
+    var y = function (rate) { return 200 - rate * 190 / max; };
+    var ns = "http://www.w3.org/2000/svg";
+
+    // Shade the alerts overlapping the chart
+
+    Object.keys(alerts).forEach(function (key) {
+      var alert = alerts[key];
+      var start = new Date(alert.start).getTime();
+      var end = alert.end ? new Date(alert.end).getTime() : to;
+      if (end < from || start > to) {
+        return;
+      }
+      var rect = document.createElementNS(ns, "rect");
+      rect.setAttribute("class", alert.status === "open" ? "alert ongoing" : "alert");
+      rect.setAttribute("x", x(Math.max(start, from)));
+      rect.setAttribute("width", Math.max(x(Math.min(end, to)) - x(Math.max(start, from)), 2));
+      rect.setAttribute("y", 0);
+      rect.setAttribute("height", 200);
+      var title = document.createElementNS(ns, "title");
+      title.textContent = alert.rule + (alert.section ? " " + alert.section : "");
+      rect.appendChild(title);
+      chart.appendChild(rect);
+    });
+
+    var line = document.createElementNS(ns, "polyline");
+    line.setAttribute("points", history.map(function (point) {
+      return x(point.time.getTime()) + "," + y(point.rate);
+    }).join(" "));
+    chart.appendChild(line);
+
+    $("chart-from").textContent = history[0].time.toLocaleTimeString();
+    $("chart-max").textContent = "max " + format(max) + " req/s";
+    $("chart-to").textContent = history[history.length - 1].time.toLocaleTimeString();
+  }
+
+  // Alerts
+
+  function addAlert(alert) {
+    alerts[alert.rule + "\u0000" + (alert.section || "") + "\u0000" + alert.start] = alert;
+  }
+
+  function renderAlerts() {
+    var sorted = Object.keys(alerts).map(function (key) { return alerts[key]; });
+    sorted.sort(function (a, b) { return new Date(b.start) - new Date(a.start); });
+
+    fill($("alerts"), header(["status", "rule", "section", "metric", "value", "start", "end", "duration"]), sorted.map(function (alert) {
+      var rule = alert.rule + (alert.severity ? " [" + alert.severity + "]" : "");
+      var value = alert.baseline ? alert.value.toFixed(1) + "σ" : alert.value;
+      var duration = alert.status === "open" ? "ongoing" : formatDuration(alert.duration);
+      return row([el("span", "badge " + alert.status, [alert.status]), rule, alert.section || "", alert.metric, value,
+        formatTime(alert.start), alert.end ? formatTime(alert.end) : "", duration], alert.status);
+    }), "no alert");
+  }
+
+  // Health
+
+  function renderHealth() {
+    getJSON("api/health", function (health) {
+      var text = health.lines + " lines";
+      if (health.errors > 0) {
+        text += ", " + health.errors + " could not be processed";
+      }
+      $("health").textContent = text;
+    });
+  }
+
+  // Data sources
+
+  function getJSON(url, callback) {
+    fetch(url).then(function (resp) {
+      return resp.ok ? resp.json() : Promise.reject(resp.status);
+    }).then(callback).catch(function () {});
+  }
+
+  function setConnection(state) {
+    var badge = $("connection");
+    badge.className = "badge " + state;
+    badge.textContent = state;
+  }
+
+  function connect() {
+    var source = new EventSource("api/stream");
+    source.onopen = function () {
+      setConnection("connected");
+    };
+    source.onerror = function () {
+      // EventSource reconnects by itself
+      setConnection("disconnected");
+    };
+    source.addEventListener("stats", function (event) {
+      var stats = JSON.parse(event.data);
+      addPoint(stats);
+      renderStats(stats);
+      renderChart();
+      renderHealth();
+    });
+    source.addEventListener("alert", function (event) {
+      addAlert(JSON.parse(event.data));
+      renderAlerts();
+      renderChart();
+    });
+  }
+
+  getJSON("api/stats", function (stats) {
+    renderStats(stats);
+  });
+  getJSON("api/alerts", function (events) {
+    events.forEach(addAlert);
+    renderAlerts();
+  });
+  renderHealth();
+  connect();
+})();
@@ -0,0 +1,10 @@
+// Code generated by gen_dashboard.go from the dashboard directory. DO NOT EDIT.
+
+package main
+
+// dashboardAssets are the static files of the web dashboard by URL path
+var dashboardAssets = map[string]string{
+	"/dashboard.css": "body {\n  margin: 0;\n  font-family: -apple-system, \"Segoe UI\", Helvetica, Arial, sans-serif;\n  font-size: 14px;\n  background: #f4f5f7;\n  color: #222;\n}\n\nheader {\n  display: flex;\n  align-items: baseline;\n  gap: 1em;\n  padding: 0.5em 1em;\n  background: #222;\n  color: #eee;\n}\n\nheader h1 {\n  margin: 0;\n  font-size: 1.4em;\n}\n\nmain {\n  display: grid;\n  grid-template-columns: repeat(auto-fill, minmax(320px, 1fr));\n  gap: 1em;\n  padding: 1em;\n}\n\nsection {\n  background: #fff;\n  border-radius: 4px;\n  padding: 0.5em 1em 1em;\n  box-shadow: 0 1px 2px rgba(0, 0, 0, 0.1);\n  overflow: hidden;\n}\n\nsection.wide {\n  grid-column: 1 / -1;\n}\n\nh2 {\n  font-size: 1.1em;\n  margin: 0.5em 0;\n}\n\nh2 small {\n  font-weight: normal;\n  color: #777;\n}\n\ntable {\n  width: 100%;\n  border-collapse: collapse;\n}\n\nth, td {\n  text-align: left;\n  padding: 2px 6px;\n  border-bottom: 1px solid #eee;\n  white-space: nowrap;\n}\n\ntd.number, th.number {\n  text-align: right;\n  font-variant-numeric: tabular-nums;\n}\n\ntd.key {\n  max-width: 20em;\n  overflow: hidden;\n  text-overflow: ellipsis;\n}\n\n#summary span {\n  margin-right: 2em;\n}\n\n#summary b {\n  font-size: 1.4em;\n}\n\n#chart {\n  width: 100%;\n  height: 200px;\n  background: #fafafa;\n}\n\n#chart polyline {\n  fill: none;\n  stroke: #2c7be5;\n  stroke-width: 2;\n  vector-effect: non-scaling-stroke;\n}\n\n#chart rect.alert {\n  fill: rgba(230, 55, 87, 0.15);\n}\n\n#chart rect.alert.ongoing {\n  fill: rgba(230, 55, 87, 0.3);\n}\n\n#chart-axis {\n  display: flex;\n  justify-content: space-between;\n  color: #777;\n  font-size: 0.85em;\n}\n\n.bar {\n  display: flex;\n  height: 1.2em;\n  margin-bottom: 0.5em;\n  background: #eee;\n}\n\n.class-1xx { background: #999; }\n.class-2xx { background: #00d97e; }\n.class-3xx { background: #39afd1; }\n.class-4xx { background: #f6c343; }\n.class-5xx { background: #e63757; }\n\n.swatch {\n  display: inline-block;\n  width: 0.8em;\n  height: 0.8em;\n  margin-right: 0.4em;\n}\n\n.badge {\n  display: inline-block;\n  padding: 0 0.5em;\n  border-radius: 3px;\n  font-size: 0.85em;\n  background: #777;\n  color: #fff;\n}\n\n.badge.open, .badge.disconnected {\n  background: #e63757;\n}\n\n.badge.closed, .badge.connected {\n  background: #00d97e;\n}\n\ntr.open {\n  font-weight: bold;\n}\n\n.empty {\n  color: #999;\n  font-style: italic;\n}\n",
+	"/dashboard.js":  "// accessmon dashboard\n// The page loads the current stats and alerts from the JSON API then follows /api/stream\n// The values read from the logs are untrusted, they are only inserted as text nodes\n\n(function () {\n  \"use strict\";\n\n  var historySize = 360; // number of stats events kept for the chart\n  var history = [];      // { time: Date, rate: Number }\n  var alerts = {};       // alert events by rule, section and start\n\n  // DOM helpers\n\n  function $(id) {\n    return document.getElementById(id);\n  }\n\n  function el(tag, className, children) {\n    var node = document.createElement(tag);\n    if (className) {\n      node.className = className;\n    }\n    (children || []).forEach(function (child) {\n      node.appendChild(typeof child === \"string\" ? document.createTextNode(child) : child);\n    });\n    return node;\n  }\n\n  function row(cells, className) {\n    return el(\"tr\", className, cells.map(function (cell) {\n      if (cell instanceof Node) {\n        return el(\"td\", null, [cell]);\n      }\n      return el(\"td\", typeof cell === \"number\" ? \"number\" : \"key\", [format(cell)]);\n    }));\n  }\n\n  function header(names) {\n    return el(\"tr\", null, names.map(function (name, i) {\n      return el(\"th\", i > 0 ? \"number\" : null, [name]);\n    }));\n  }\n\n  function fill(table, head, rows, empty) {\n    table.textContent = \"\";\n    table.appendChild(head);\n    if (rows.length === 0) {\n      table.appendChild(el(\"tr\", null, [el(\"td\", \"empty\", [empty || \"no data\"])]));\n    }\n    rows.forEach(function (r) {\n      table.appendChild(r);\n    });\n  }\n\n  function format(value) {\n    if (typeof value === \"number\") {\n      return Number.isInteger(value) ? String(value) : value.toFixed(2);\n    }\n    return value === undefined || value === null ? \"\" : String(value);\n  }\n\n  function formatTime(value) {\n    var date = new Date(value);\n    return isNaN(date) || date.getFullYear() < 2 ? \"-\" : date.toLocaleString();\n  }\n\n  function formatDuration(seconds) {\n    if (seconds < 60) {\n      return seconds.toFixed(0) + \"s\";\n    }\n    if (seconds < 3600) {\n      return (seconds / 60).toFixed(1) + \"m\";\n    }\n    return (seconds / 3600).toFixed(1) + \"h\";\n  }\n\n  // Stats\n\n  function renderStats(stats) {\n    $(\"window\").textContent = \"( last \" + formatDuration(stats.window) + \" )\";\n    $(\"last\").textContent = \"last request : \" + formatTime(stats.time);\n\n    var summary = $(\"summary\");\n    summary.textContent = \"\";\n    [\n      [\"req/s\", stats.request_rate],\n      [\"requests\", stats.count],\n      [\"server errors %\", stats.server_error_percent],\n      [\"HTTP2 %\", stats.http2_percent],\n      [\"IPv6 %\", stats.ipv6_percent]\n    ].forEach(function (item) {\n      summary.appendChild(el(\"span\", null, [el(\"b\", null, [format(item[1])]), \" \" + item[0]]));\n    });\n\n    renderClasses(stats);\n    renderLatency(stats);\n\n    var top = function (values) {\n      return values.map(function (value) {\n        return row([value.key, value.count, value.request_rate]);\n      });\n    };\n    fill($(\"sections\"), header([\"section\", \"count\", \"req/s\", \"p50 ms\", \"p99 ms\"]), stats.top_sections.map(function (section) {\n      var latency = section.latency || {};\n      return row([section.key, section.count, section.request_rate, latency.p50, latency.p99]);\n    }));\n    fill($(\"users\"), header([\"user\", \"count\", \"req/s\"]), top(stats.top_users));\n    fill($(\"sources\"), header([\"source\", \"count\", \"req/s\"]), top(stats.top_sources));\n  }\n\n  function renderClasses(stats) {\n    var classes = Object.keys(stats.status_classes || {}).sort();\n    var bar = $(\"classes-bar\");\n    bar.textContent = \"\";\n    var rows = classes.map(function (name) {\n      var count = stats.status_classes[name];\n      var percent = stats.count > 0 ? count * 100 / stats.count : 0;\n      var part = el(\"div\", \"class-\" + name);\n      part.style.width = percent + \"%\";\n      part.title = name + \" \" + percent.toFixed(1) + \"%\";\n      bar.appendChild(part);\n      return row([el(\"span\", null, [el(\"span\", \"swatch class-\" + name), name]), count, percent]);\n    });\n    fill($(\"classes\"), header([\"class\", \"count\", \"%\"]), rows);\n  }\n\n  function renderLatency(stats) {\n    var latency = stats.latency;\n    var rows = latency ? [row([\"ms\", latency.p50, latency.p90, latency.p99, latency.max])] : [];\n    fill($(\"latency\"), header([\"\", \"p50\", \"p90\", \"p99\", \"max\"]), rows, \"the log format provides no request duration\");\n  }\n\n  // Chart\n\n  function addPoint(stats) {\n    var time = new Date(stats.time);\n    if (history.length > 0 && time <= history[history.length - 1].time) {\n      return;\n    }\n    history.push({ time: time, rate: stats.request_rate });\n    if (history.length > historySize) {\n      history.shift();\n    }\n  }\n\n  function renderChart() {\n    var chart = $(\"chart\");\n    chart.textContent = \"\";\n    if (history.length === 0) {\n      return;\n    }\n\n    var from = history[0].time.getTime();\n    var to = history[history.length - 1].time.getTime();\n    var span = Math.max(to - from, 1);\n    var max = Math.max.apply(null, history.map(function (point) { return point.rate; })) || 1;\n    var x = function (time) { return (time - from) * 1000 / span; };\n    var y = function (rate) { return 200 - rate * 190 / max; };\n    var ns = \"http://www.w3.org/2000/svg\";\n\n    // Shade the alerts overlapping the chart\n\n    Object.keys(alerts).forEach(function (key) {\n      var alert = alerts[key];\n      var start = new Date(alert.start).getTime();\n      var end = alert.end ? new Date(alert.end).getTime() : to;\n      if (end < from || start > to) {\n        return;\n      }\n      var rect = document.createElementNS(ns, \"rect\");\n      rect.setAttribute(\"class\", alert.status === \"open\" ? \"alert ongoing\" : \"alert\");\n      rect.setAttribute(\"x\", x(Math.max(start, from)));\n      rect.setAttribute(\"width\", Math.max(x(Math.min(end, to)) - x(Math.max(start, from)), 2));\n      rect.setAttribute(\"y\", 0);\n      rect.setAttribute(\"height\", 200);\n      var title = document.createElementNS(ns, \"title\");\n      title.textContent = alert.rule + (alert.section ? \" \" + alert.section : \"\");\n      rect.appendChild(title);\n      chart.appendChild(rect);\n    });\n\n    var line = document.createElementNS(ns, \"polyline\");\n    line.setAttribute(\"points\", history.map(function (point) {\n      return x(point.time.getTime()) + \",\" + y(point.rate);\n    }).join(\" \"));\n    chart.appendChild(line);\n\n    $(\"chart-from\").textContent = history[0].time.toLocaleTimeString();\n    $(\"chart-max\").textContent = \"max \" + format(max) + \" req/s\";\n    $(\"chart-to\").textContent = history[history.length - 1].time.toLocaleTimeString();\n  }\n\n  // Alerts\n\n  function addAlert(alert) {\n    alerts[alert.rule + \"\\u0000\" + (alert.section || \"\") + \"\\u0000\" + alert.start] = alert;\n  }\n\n  function renderAlerts() {\n    var sorted = Object.keys(alerts).map(function (key) { return alerts[key]; });\n    sorted.sort(function (a, b) { return new Date(b.start) - new Date(a.start); });\n\n    fill($(\"alerts\"), header([\"status\", \"rule\", \"section\", \"metric\", \"value\", \"start\", \"end\", \"duration\"]), sorted.map(function (alert) {\n      var rule = alert.rule + (alert.severity ? \" [\" + alert.severity + \"]\" : \"\");\n      var value = alert.baseline ? alert.value.toFixed(1) + \"σ\" : alert.value;\n      var duration = alert.status === \"open\" ? \"ongoing\" : formatDuration(alert.duration);\n      return row([el(\"span\", \"badge \" + alert.status, [alert.status]), rule, alert.section || \"\", alert.metric, value,\n        formatTime(alert.start), alert.end ? formatTime(alert.end) : \"\", duration], alert.status);\n    }), \"no alert\");\n  }\n\n  // Health\n\n  function renderHealth() {\n    getJSON(\"api/health\", function (health) {\n      var text = health.lines + \" lines\";\n      if (health.errors > 0) {\n        text += \", \" + health.errors + \" could not be processed\";\n      }\n      $(\"health\").textContent = text;\n    });\n  }\n\n  // Data sources\n\n  function getJSON(url, callback) {\n    fetch(url).then(function (resp) {\n      return resp.ok ? resp.json() : Promise.reject(resp.status);\n    }).then(callback).catch(function () {});\n  }\n\n  function setConnection(state) {\n    var badge = $(\"connection\");\n    badge.className = \"badge \" + state;\n    badge.textContent = state;\n  }\n\n  function connect() {\n    var source = new EventSource(\"api/stream\");\n    source.onopen = function () {\n      setConnection(\"connected\");\n    };\n    source.onerror = function () {\n      // EventSource reconnects by itself\n      setConnection(\"disconnected\");\n    };\n    source.addEventListener(\"stats\", function (event) {\n      var stats = JSON.parse(event.data);\n      addPoint(stats);\n      renderStats(stats);\n      renderChart();\n      renderHealth();\n    });\n    source.addEventListener(\"alert\", function (event) {\n      addAlert(JSON.parse(event.data));\n      renderAlerts();\n      renderChart();\n    });\n  }\n\n  getJSON(\"api/stats\", function (stats) {\n    renderStats(stats);\n  });\n  getJSON(\"api/alerts\", function (events) {\n    events.forEach(addAlert);\n    renderAlerts();\n  });\n  renderHealth();\n  connect();\n})();\n",
+	"/index.html":    "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n  <meta charset=\"utf-8\">\n  <meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n  <title>accessmon</title>\n  <link rel=\"stylesheet\" href=\"dashboard.css\">\n</head>\n<body>\n  <header>\n    <h1>accessmon</h1>\n    <span id=\"connection\" class=\"badge\">connecting</span>\n    <span id=\"last\"></span>\n    <span id=\"health\"></span>\n  </header>\n\n  <main>\n    <section class=\"wide\">\n      <h2>Requests per second <small id=\"window\"></small></h2>\n      <div id=\"summary\"></div>\n      <svg id=\"chart\" viewBox=\"0 0 1000 200\" preserveAspectRatio=\"none\"></svg>\n      <div id=\"chart-axis\"><span id=\"chart-from\"></span><span id=\"chart-max\"></span><span id=\"chart-to\"></span></div>\n    </section>\n\n    <section>\n      <h2>Status classes</h2>\n      <div id=\"classes-bar\" class=\"bar\"></div>\n      <table id=\"classes\"></table>\n    </section>\n\n    <section>\n      <h2>Latency</h2>\n      <table id=\"latency\"></table>\n    </section>\n\n    <section>\n      <h2>Top sections</h2>\n      <table id=\"sections\"></table>\n    </section>\n\n    <section>\n      <h2>Top users</h2>\n      <table id=\"users\"></table>\n    </section>\n\n    <section>\n      <h2>Top sources</h2>\n      <table id=\"sources\"></table>\n    </section>\n\n    <section class=\"wide\">\n      <h2>Alerts</h2>\n      <table id=\"alerts\"></table>\n    </section>\n  </main>\n\n  <script src=\"dashboard.js\"></script>\n</body>\n</html>\n",
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/camathieu/accessmon"
+)
+
+// detectFormats are the log formats tried by the format detection in order of preference
+var detectFormats = []string{"common", "combined", "vhost_combined", "json", "elb", "w3c_extended"}
+
+// errNoSample is returned by detectParser when the logfile has no line to sample ( empty or freshly rotated )
+var errNoSample = errors.New("unable to detect log format : no line to sample")
+
+func sampleLogFile(path string, sample int) (lines []string, err error) {
+
+	// Open file
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Read the first non empty lines
+
+	scanner := bufio.NewScanner(file)
+	for len(lines) < sample && scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+func detectParser(path string, sample int, jsonFields string, jsonTime string, jsonDurationUnit time.Duration) (format string, rate float64, err error) {
+	lines, err := sampleLogFile(path, sample)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(lines) == 0 {
+		return "", 0, errNoSample
+	}
+
+	var candidates []*accessmon.ParserCandidate
+	for _, format := range detectFormats {
+		format := format
+		candidates = append(candidates, &accessmon.ParserCandidate{
+			Name: format,
+			New:  func() (accessmon.Parser, error) { return newParser(format, jsonFields, jsonTime, jsonDurationUnit) },
+		})
+	}
+
+	candidate, rate, err := accessmon.DetectParser(lines, candidates)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return candidate.Name, rate, nil
+}
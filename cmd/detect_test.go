@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectParser(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "access.log_")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(tmpfile.Name())
+	}()
+
+	lines := []string{
+		"www.example.com:443 127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12 \"-\" \"curl/7.64.0\"",
+		"",
+		"www.example.com:443 ::1 - - [09/May/2018:16:00:43 +0000] \"GET / HTTP/2.0\" 200 1024 \"-\" \"curl/7.64.0\"",
+		"127.0.0.1 - mary [09/May/2018:16:00:44 +0000] \"POST /api/user HTTP/1.0\" 503 12",
+	}
+
+	for _, line := range lines {
+		_, err = tmpfile.WriteString(line + "\n")
+		require.NoError(t, err)
+	}
+
+	err = tmpfile.Close()
+	require.NoError(t, err)
+
+	format, rate, err := detectParser(tmpfile.Name(), 10, defaultJSONFields, "", time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "vhost_combined", format)
+	require.InDelta(t, 0.66, rate, 0.01)
+
+	format, rate, err = detectParser(tmpfile.Name(), 1, defaultJSONFields, "", time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "vhost_combined", format)
+	require.Equal(t, float64(1), rate)
+}
+
+func TestDetectParserError(t *testing.T) {
+	_, _, err := detectParser("invalid_file_name", 10, defaultJSONFields, "", time.Second)
+	require.Error(t, err)
+
+	tmpfile, err := ioutil.TempFile("", "access.log_")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(tmpfile.Name())
+	}()
+
+	_, err = tmpfile.WriteString("garbage\n")
+	require.NoError(t, err)
+
+	err = tmpfile.Close()
+	require.NoError(t, err)
+
+	_, _, err = detectParser(tmpfile.Name(), 10, defaultJSONFields, "", time.Second)
+	require.Error(t, err)
+	require.NotEqual(t, errNoSample, err)
+
+	// An empty logfile has no line to sample
+
+	err = ioutil.WriteFile(tmpfile.Name(), []byte("\n"), 0644)
+	require.NoError(t, err)
+
+	_, _, err = detectParser(tmpfile.Name(), 10, defaultJSONFields, "", time.Second)
+	require.Equal(t, errNoSample, err)
+}
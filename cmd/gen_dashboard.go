@@ -0,0 +1,48 @@
+//go:build ignore
+// +build ignore
+
+// gen_dashboard writes the files of the dashboard directory to dashboard_assets.go
+// so that they are built into the binary without go:embed and its Go 1.16 requirement
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+)
+
+func main() {
+	files, err := ioutil.ReadDir("dashboard")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("// Code generated by gen_dashboard.go from the dashboard directory. DO NOT EDIT.\n\n")
+	buffer.WriteString("package main\n\n")
+	buffer.WriteString("// dashboardAssets are the static files of the web dashboard by URL path\n")
+	buffer.WriteString("var dashboardAssets = map[string]string{\n")
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join("dashboard", file.Name()))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(&buffer, "\t%q: %q,\n", "/"+file.Name(), data)
+	}
+	buffer.WriteString("}\n")
+
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = ioutil.WriteFile("dashboard_assets.go", source, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
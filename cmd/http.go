@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/camathieu/accessmon"
+)
+
+//go:generate go run gen_dashboard.go
+
+// serveHTTP serves the Prometheus metrics on /metrics, the JSON API on /api/,
+// the Server-Sent Events on /api/stream and the web dashboard on / in the background
+func serveHTTP(listener net.Listener, exporter *accessmon.PrometheusExporter, mon *accessmon.Monitor, stream *accessmon.Stream) (shutdown func()) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveDashboard)
+	mux.Handle("/metrics", exporter)
+	mux.Handle("/api/", accessmon.NewAPI(mon))
+	mux.Handle("/api/stream", stream)
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	return func() { _ = server.Close() }
+}
+
+// serveDashboard serves the static files of the web dashboard, / being the index page
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if path == "/" {
+		path = "/index.html"
+	}
+	asset, ok := dashboardAssets[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, path, time.Time{}, strings.NewReader(asset))
+}
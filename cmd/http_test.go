@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/camathieu/accessmon"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeHTTP(t *testing.T) {
+	exporter := accessmon.NewPrometheusExporter()
+	exporter.Observe(nil, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	mon, err := accessmon.NewMonitor(&accessmon.Config{StoreWindow: time.Minute})
+	require.NoError(t, err)
+	_, _ = mon.AddLine("invalid")
+
+	stream := accessmon.NewStream()
+	defer stream.Close()
+
+	shutdown := serveHTTP(listener, exporter, mon, stream)
+	defer shutdown()
+
+	get := func(path string) string {
+		resp, err := http.Get("http://" + listener.Addr().String() + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return string(body)
+	}
+
+	require.Contains(t, get("/"), "<title>accessmon</title>")
+	require.Contains(t, get("/dashboard.js"), "new EventSource(\"api/stream\")")
+	require.Contains(t, get("/metrics"), "accessmon_lines_total 1\n")
+	require.Contains(t, get("/api/health"), `"errors":1`)
+	require.Contains(t, get("/api/stats"), `"count":0`)
+	require.Equal(t, "[]\n", get("/api/alerts"))
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/missing.js")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get("http://" + listener.Addr().String() + "/api/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+}
+
+func TestDashboardAssets(t *testing.T) {
+	files, err := ioutil.ReadDir("dashboard")
+	require.NoError(t, err)
+	require.Len(t, dashboardAssets, len(files), "run go generate to update dashboard_assets.go")
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join("dashboard", file.Name()))
+		require.NoError(t, err)
+		require.Equal(t, string(data), dashboardAssets["/"+file.Name()], "run go generate to update dashboard_assets.go")
+	}
+}
@@ -3,15 +3,44 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/camathieu/accessmon"
 )
 
+// defaultJSONFields matches the usual nginx escape=json log_format variable names
+const defaultJSONFields = "time=time_iso8601,source_ip=remote_addr,user=remote_user,request=request,code=status,size=body_bytes_sent,referrer=http_referer,user_agent=http_user_agent,duration=request_time"
+
+// defaultFormat is the log format used when none is given or none can be detected
+const defaultFormat = "common"
+
+// vhostCombinedFormat is the vhost_combined LogFormat shipped by Debian based Apache packages
+const vhostCombinedFormat = "%v:%p %h %l %u %t \"%r\" %>s %O \"%{Referer}i\" \"%{User-Agent}i\""
+
+// smtpPasswordEnv is the environment variable holding the SMTP password
+// The password is not taken as a flag to keep it out of the process list and the shell history
+const smtpPasswordEnv = "ACCESSMON_SMTP_PASSWORD"
+
+// smtpPassword reads the SMTP password from the file or from the environment if no file is given
+func smtpPassword(file string) (password string, err error) {
+	if file == "" {
+		return os.Getenv(smtpPasswordEnv), nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
 func cleanDisplay() {
 	fmt.Print("\033[H\033[2J")
 }
@@ -20,6 +49,10 @@ func perSecond(value int, window time.Duration) float64 {
 	return float64(value) / window.Seconds()
 }
 
+func formatLatency(latency *accessmon.Latency) string {
+	return fmt.Sprintf("p50 %s, p90 %s, p99 %s, max %s", latency.P50, latency.P90, latency.P99, latency.Max)
+}
+
 func displayStats(stats *accessmon.Stats, now time.Time, window time.Duration) {
 	fmt.Println("")
 
@@ -37,13 +70,25 @@ func displayStats(stats *accessmon.Stats, now time.Time, window time.Duration) {
 	fmt.Printf(" ServerError : %.3f%%\n", stats.ServerError)
 	fmt.Printf(" HTTP2 : %.1f%%\n", stats.HTTP2)
 	fmt.Printf(" IPv6 : %.1f%%\n", stats.Ipv6)
+	if stats.Latency != nil {
+		fmt.Printf(" Latency : %s\n", formatLatency(stats.Latency))
+	}
 	fmt.Println("")
 	fmt.Printf(" top source : %s (%.1f req/s)\n", stats.TopSources[0].Key, perSecond(stats.TopSources[0].Count, window))
 	fmt.Printf(" top section : %s (%.1f req/s)\n", stats.TopSection[0].Key, perSecond(stats.TopSection[0].Count, window))
+	if latency, ok := stats.SectionLatency[stats.TopSection[0].Key]; ok {
+		fmt.Printf("   latency : %s\n", formatLatency(latency))
+	}
 	fmt.Printf(" top user : %s (%.1f req/s)\n", stats.TopUsers[0].Key, perSecond(stats.TopUsers[0].Count, window))
 	fmt.Println("")
 }
 
+func displayErrors(mon *accessmon.Monitor) {
+	if mon.Errors() > 0 {
+		fmt.Printf("Warning : %d/%d lines could not be processed, check the log format\n", mon.Errors(), mon.Lines())
+	}
+}
+
 func displayAlerts(alerts []*accessmon.Alert) {
 	for _, alert := range alerts {
 		displayAlert(alert)
@@ -51,17 +96,162 @@ func displayAlerts(alerts []*accessmon.Alert) {
 }
 
 func displayAlert(alert *accessmon.Alert) {
-	fmt.Printf("AL - High traffic above threshold at %s ( %.3f requests per second )\n", alert.Start, alert.Value)
+	fmt.Println(alertStartMessage(alert))
 	if !alert.IsOngoing() {
-		fmt.Printf("OK - High traffic under threshold at %s. Alert duration %s\n", alert.End, alert.End.Sub(alert.Start))
+		fmt.Println(alertEndMessage(alert))
 	}
 }
 
 func displayAlertOffline(alert *accessmon.Alert) {
 	if alert.IsOngoing() {
-		fmt.Printf("AL - High traffic above threshold at %s ( %.3f requests per second )\n", alert.Start, alert.Value)
+		fmt.Println(alertStartMessage(alert))
 	} else {
-		fmt.Printf("OK - High traffic under threshold at %s. Alert duration %s\n", alert.End, alert.End.Sub(alert.Start))
+		fmt.Println(alertEndMessage(alert))
+	}
+}
+
+func alertStartMessage(alert *accessmon.Alert) string {
+	var value string
+	switch {
+	case alert.Baseline:
+		value = fmt.Sprintf("%.1f standard deviations above baseline", alert.Value)
+	case alert.Metric == accessmon.MetricLatency:
+		value = fmt.Sprintf("p%g %s", alert.Percentile, seconds(alert.Value))
+	case alert.Metric == accessmon.MetricErrorRate:
+		value = fmt.Sprintf("%.1f%% errors", alert.Value)
+	default:
+		value = fmt.Sprintf("%.3f requests per second", alert.Value)
+	}
+	return fmt.Sprintf("AL - %s above threshold at %s ( %s )", alertSubject(alert), alert.Start, value) + alertRuleSuffix(alert)
+}
+
+func alertEndMessage(alert *accessmon.Alert) string {
+	return fmt.Sprintf("OK - %s under threshold at %s. Alert duration %s", alertSubject(alert), alert.End, alert.End.Sub(alert.Start)) + alertRuleSuffix(alert)
+}
+
+func alertSubject(alert *accessmon.Alert) (subject string) {
+	switch alert.Metric {
+	case accessmon.MetricLatency:
+		subject = "High latency"
+	case accessmon.MetricErrorRate:
+		subject = "High error rate"
+	default:
+		subject = "High traffic"
+	}
+	if alert.Section != "" {
+		subject += " on " + alert.Section
+	}
+	return subject
+}
+
+func alertRuleSuffix(alert *accessmon.Alert) string {
+	if alert.Rule == "" {
+		return ""
+	}
+	if alert.Severity == "" {
+		return fmt.Sprintf(" [%s]", alert.Rule)
+	}
+	return fmt.Sprintf(" [%s/%s]", alert.Rule, alert.Severity)
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+// stringsFlag is a flag.Value accumulating the values of a repeated flag
+type stringsFlag []string
+
+func (values *stringsFlag) String() string {
+	return strings.Join(*values, ",")
+}
+
+func (values *stringsFlag) Set(value string) error {
+	*values = append(*values, value)
+	return nil
+}
+
+// tagsFlag parses a comma separated list of key=value
+// host=www1,env=prod
+func tagsFlag(spec string) (tags map[string]string, err error) {
+	tags = make(map[string]string)
+	for _, tag := range strings.Split(spec, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		tags[parts[0]] = parts[1]
+	}
+	return tags, nil
+}
+
+// jsonFieldsFlag parses a comma separated list of field=path
+// time=ts,source_ip=request.remote_ip,code=status
+func jsonFieldsFlag(spec string) (fields *accessmon.JSONFields, err error) {
+	fields = &accessmon.JSONFields{}
+
+	targets := map[string]*string{
+		"source_ip":    &fields.SourceIP,
+		"user":         &fields.User,
+		"time":         &fields.Time,
+		"method":       &fields.Method,
+		"path":         &fields.Path,
+		"http_version": &fields.HTTPVersion,
+		"code":         &fields.Code,
+		"size":         &fields.Size,
+		"referrer":     &fields.Referrer,
+		"user_agent":   &fields.UserAgent,
+		"request":      &fields.Request,
+		"duration":     &fields.Duration,
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid json field mapping %q", pair)
+		}
+		target, ok := targets[strings.TrimSpace(kv[0])]
+		if !ok {
+			return nil, fmt.Errorf("unknown json field %q", kv[0])
+		}
+		*target = strings.TrimSpace(kv[1])
+	}
+
+	return fields, nil
+}
+
+func newParser(format string, jsonFields string, jsonTime string, jsonDurationUnit time.Duration) (parser accessmon.Parser, err error) {
+	switch format {
+	case "common":
+		return &accessmon.W3CParser{}, nil
+	case "combined":
+		return &accessmon.CombinedParser{}, nil
+	case "w3c_extended":
+		return &accessmon.W3CExtendedParser{}, nil
+	case "elb":
+		return &accessmon.ELBParser{}, nil
+	case "vhost_combined":
+		return accessmon.NewApacheFormatParser(vhostCombinedFormat)
+	case "json":
+		fields, err := jsonFieldsFlag(jsonFields)
+		if err != nil {
+			return nil, err
+		}
+		fields.DurationUnit = jsonDurationUnit
+		return accessmon.NewJSONParser(fields, jsonTime)
+	}
+
+	// custom formats : nginx variables start with a $ and Apache directives with a %
+	switch {
+	case strings.Contains(format, "$"):
+		return accessmon.NewNginxFormatParser(format)
+	case strings.Contains(format, "%"):
+		return accessmon.NewApacheFormatParser(format)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
 	}
 }
 
@@ -70,10 +260,62 @@ func main() {
 	refresh := flag.Duration("refresh", 10*time.Second, "screen refresh interval ( online mode only )")
 	offline := flag.Bool("offline", false, "offline mode ( cat )")
 	generate := flag.Bool("generate", false, "generator mode")
+	format := flag.String("format", defaultFormat, "log format ( auto, common, combined, vhost_combined, json, elb, w3c_extended, Apache LogFormat or nginx log_format string )")
+	detectLines := flag.Int("detect-lines", 100, "number of lines to sample for log format detection ( auto format only )")
+	jsonFields := flag.String("json-fields", defaultJSONFields, "json log format field=path mapping ( json format only )")
+	jsonTime := flag.String("json-time", "", "json log format time layout, epoch or epoch_ms ( json format only, default RFC3339 )")
+	jsonDurationUnit := flag.Duration("json-duration-unit", time.Second, "json log format duration unit ( json format only )")
 
 	config := &accessmon.Config{}
 	flag.DurationVar(&config.AlertWindow, "window", 2*time.Minute, "total request per second moving average alerting window")
 	flag.Float64Var(&config.AlertThreshold, "threshold", 10, "total request per second moving average alerting threshold")
+	flag.DurationVar(&config.AlertClearWindow, "clear-window", 0, "total request per second moving average alert clearing window ( window if 0 )")
+	flag.Float64Var(&config.AlertClearThreshold, "clear-threshold", 0, "total request per second moving average alert clearing threshold ( threshold if 0 )")
+	flag.DurationVar(&config.LatencyAlertWindow, "latency-window", 2*time.Minute, "p95 latency alerting window")
+	flag.DurationVar(&config.LatencyAlertThreshold, "latency-threshold", 0, "p95 latency alerting threshold ( disabled if 0 )")
+	flag.DurationVar(&config.LatencyAlertClearWindow, "latency-clear-window", 0, "p95 latency alert clearing window ( latency-window if 0 )")
+	flag.DurationVar(&config.LatencyAlertClearThreshold, "latency-clear-threshold", 0, "p95 latency alert clearing threshold ( latency-threshold if 0 )")
+	flag.DurationVar(&config.ErrorAlertWindow, "error-window", 2*time.Minute, "error rate alerting window")
+	flag.Float64Var(&config.ErrorAlertThreshold, "error-threshold", 0, "error rate alerting threshold in percent ( disabled if 0 )")
+	flag.DurationVar(&config.ErrorAlertClearWindow, "error-clear-window", 0, "error rate alert clearing window ( error-window if 0 )")
+	flag.Float64Var(&config.ErrorAlertClearThreshold, "error-clear-threshold", 0, "error rate alert clearing threshold in percent ( error-threshold if 0 )")
+	flag.IntVar(&config.ErrorAlertClass, "error-class", 5, "status code class counted as errors by the error rate alerting ( 5 for 5xx )")
+	flag.IntVar(&config.ErrorAlertMinRequests, "error-min-requests", 10, "minimum number of requests in the window for the error rate alerting")
+	flag.DurationVar(&config.SectionAlertWindow, "section-window", 2*time.Minute, "per section request per second moving average alerting window")
+	flag.Float64Var(&config.SectionAlertThreshold, "section-threshold", 0, "per section request per second moving average alerting threshold ( disabled if 0 )")
+	flag.DurationVar(&config.BaselineAlertWindow, "baseline-window", 2*time.Minute, "request per second baseline alerting window and sampling interval")
+	flag.Float64Var(&config.BaselineAlertThreshold, "baseline-threshold", 0, "request per second baseline alerting threshold in standard deviations ( disabled if 0 )")
+	flag.BoolVar(&config.BaselineAlertSeasonal, "baseline-seasonal", false, "learn a request per second baseline for each hour of the week")
+	var webhooks stringsFlag
+	flag.Var(&webhooks, "webhook", "webhook URL to POST the alerts to ( can be repeated )")
+	webhookRetries := flag.Int("webhook-retries", 3, "number of retries of a failed webhook delivery")
+	alertExec := flag.String("alert-exec", "", "shell command to run when an alert starts or ends ( details in ACCESSMON_* environment variables and JSON on stdin )")
+	alertExecTimeout := flag.Duration("alert-exec-timeout", 30*time.Second, "alert command timeout")
+	smtpConfig := &accessmon.SMTPConfig{}
+	var smtpTo stringsFlag
+	flag.StringVar(&smtpConfig.Addr, "smtp-addr", "", "SMTP server host:port to email the alerts through")
+	flag.StringVar(&smtpConfig.From, "smtp-from", "accessmon@localhost", "alert email sender address")
+	flag.Var(&smtpTo, "smtp-to", "alert email recipient address ( can be repeated )")
+	flag.StringVar(&smtpConfig.Username, "smtp-username", "", "SMTP authentication username")
+	smtpPasswordFile := flag.String("smtp-password-file", "", "file containing the SMTP authentication password ( "+smtpPasswordEnv+" environment variable if empty )")
+	flag.BoolVar(&smtpConfig.StartTLS, "smtp-starttls", false, "require SMTP STARTTLS")
+	flag.DurationVar(&smtpConfig.Batch, "smtp-batch", 30*time.Second, "alert transitions within the interval are sent in a single email")
+	tuiMode := flag.Bool("tui", false, "full-screen interactive terminal UI ( online mode only )")
+	httpListen := flag.String("http-listen", "", "address to serve the web dashboard on /, the Prometheus metrics on /metrics, the JSON API on /api/ and the live event stream on /api/stream ( disabled if empty )")
+	httpWindow := flag.Duration("http-window", 5*time.Minute, "largest stats window served by the JSON API")
+	statsdConfig := &accessmon.StatsDConfig{}
+	flag.StringVar(&statsdConfig.Addr, "statsd-addr", "", "StatsD server UDP host:port to push the stats of each refresh interval to ( online mode only )")
+	flag.StringVar(&statsdConfig.Prefix, "statsd-prefix", "accessmon", "StatsD metric name prefix")
+	statsdTags := flag.String("statsd-tags", "", "comma separated DogStatsD tags added to every metric ( key:value )")
+	flag.BoolVar(&statsdConfig.DogStatsD, "statsd-dogstatsd", true, "use DogStatsD tags, otherwise the section is part of the metric name")
+	influxConfig := &accessmon.InfluxConfig{}
+	flag.StringVar(&influxConfig.URL, "influx-url", "", "InfluxDB write URL ( http://host:8086/write?db=accessmon or udp://host:8089 ) to push the stats of each refresh interval to ( online mode only )")
+	flag.StringVar(&influxConfig.Token, "influx-token", "", "InfluxDB API token")
+	influxTags := flag.String("influx-tags", "", "comma separated InfluxDB tags added to every point ( key=value )")
+	graphiteConfig := &accessmon.GraphiteConfig{}
+	flag.StringVar(&graphiteConfig.Addr, "graphite-addr", "", "Graphite plaintext TCP host:port to push the stats of each refresh interval to ( online mode only )")
+	flag.StringVar(&graphiteConfig.Prefix, "graphite-prefix", "accessmon", "Graphite metric path prefix")
+	rules := flag.String("rules", "", "alerting rules YAML file")
 
 	flag.Parse()
 
@@ -89,31 +331,193 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *rules != "" {
+		var err error
+		config.Rules, err = accessmon.LoadRules(*rules)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// we need to store at least enough requests in memory to generate statistics
 	// for the last refresh interval
 	config.StoreWindow = *refresh
+	if *httpListen != "" && *httpWindow > config.StoreWindow {
+		config.StoreWindow = *httpWindow
+	}
+	if *tuiMode && !*offline && tuiMaxWindow > config.StoreWindow {
+		config.StoreWindow = tuiMaxWindow
+	}
+
+	if *format == "auto" {
+		detected, rate, err := detectParser(*path, *detectLines, *jsonFields, *jsonTime, *jsonDurationUnit)
+		switch {
+		case err == errNoSample:
+			// an empty or freshly rotated logfile must not prevent tailing it
+			fmt.Printf("Warning : no line to detect the log format, using the %s format\n", defaultFormat)
+			*format = defaultFormat
+		case err != nil:
+			log.Fatal(err)
+		default:
+			fmt.Printf("Detected log format : %s ( %.1f%% of sampled lines parsed )\n", detected, rate*100)
+			*format = detected
+		}
+	}
+
+	parser, err := newParser(*format, *jsonFields, *jsonTime, *jsonDurationUnit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.Parser = parser
+
+	if len(webhooks) > 0 {
+		config.Notifiers = append(config.Notifiers, accessmon.NewWebhookNotifier(&accessmon.WebhookConfig{URLs: webhooks, Retries: *webhookRetries}))
+	}
+
+	if *alertExec != "" {
+		config.Notifiers = append(config.Notifiers, accessmon.NewExecNotifier(&accessmon.ExecConfig{Command: *alertExec, Timeout: *alertExecTimeout}))
+	}
+
+	if smtpConfig.Addr != "" {
+		smtpConfig.To = smtpTo
+		smtpConfig.Password, err = smtpPassword(*smtpPasswordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		notifier, err := accessmon.NewSMTPNotifier(smtpConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.Notifiers = append(config.Notifiers, notifier)
+	}
 
-	mon := accessmon.NewMonitor(config)
+	var pushers []accessmon.StatsPusher
+	var listener net.Listener
+	var exporter *accessmon.PrometheusExporter
+	var stream *accessmon.Stream
+	if *httpListen != "" {
+		listener, err = net.Listen("tcp", *httpListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		exporter = accessmon.NewPrometheusExporter()
+		config.Observers = append(config.Observers, exporter)
+		config.Notifiers = append(config.Notifiers, exporter)
+
+		// The stream is fed with the stats of each refresh interval like the metrics backends
+		stream = accessmon.NewStream()
+		config.Notifiers = append(config.Notifiers, stream)
+	}
+
+	if statsdConfig.Addr != "" {
+		if *statsdTags != "" {
+			statsdConfig.Tags = strings.Split(*statsdTags, ",")
+		}
+		pusher, err := accessmon.NewStatsDPusher(statsdConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pushers = append(pushers, pusher)
+	}
+
+	if influxConfig.URL != "" {
+		influxConfig.Tags, err = tagsFlag(*influxTags)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pusher, err := accessmon.NewInfluxPusher(influxConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pushers = append(pushers, pusher)
+	}
+
+	if graphiteConfig.Addr != "" {
+		pusher, err := accessmon.NewGraphitePusher(graphiteConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pushers = append(pushers, pusher)
+	}
+
+	mon, err := accessmon.NewMonitor(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	shutdownHTTP := func() {}
+	if listener != nil {
+		shutdownHTTP = serveHTTP(listener, exporter, mon, stream)
+	}
 
 	if *offline {
-		err := catLogFile(*path, mon)
+		err = catLogFile(*path, mon)
 		if err != nil {
 			log.Fatal(err)
 		}
+		displayErrors(mon)
+		shutdownHTTP()
+		mon.Close()
 	} else {
-		shutdown, err := tailLogFile(*path, *refresh, mon)
+		// the file is tailed from its end so the stateful parsers are fed with the directives already written
+		if hasDirectives(parser) {
+			err = readDirectives(*path, parser)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		display := func() { displayRefresh(mon, *refresh) }
+		stopTUI := func() {}
+		var ui *tui
+		if *tuiMode {
+			ui = newTUI(mon, *refresh, os.Stdout, terminalSize)
+			stopTUI, err = startTUI(ui)
+			if err != nil {
+				log.Fatal(err)
+			}
+			display = ui.Tick
+		}
+
+		var live accessmon.StatsPusher
+		if stream != nil {
+			live = stream.StatsPusher()
+		}
+
+		shutdown, err := tailLogFile(*path, *refresh, mon, pushers, live, display)
 		if err != nil {
+			stopTUI()
 			log.Fatal(err)
 		}
 
-		c := make(chan os.Signal)
+		// exit is called both on interrupt and when the terminal UI quits, only the first call cleans up
+		var once sync.Once
+		exit := func() {
+			once.Do(func() {
+				shutdown()
+				stopTUI()
+				shutdownHTTP()
+				mon.Close()
+				for _, pusher := range pushers {
+					_ = pusher.Close()
+				}
+				os.Exit(0)
+			})
+		}
+
+		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 		go func() {
 			<-c
-			shutdown()
-			os.Exit(0)
+			exit()
 		}()
 
+		if ui != nil {
+			// The terminal UI handles the interrupt key itself
+			ui.readKeys(os.Stdin)
+			exit()
+		}
+
 		select {}
 	}
 }
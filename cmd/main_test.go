@@ -1,7 +1,140 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
 	"time"
+
+	"github.com/camathieu/accessmon"
+	"github.com/stretchr/testify/require"
 )
 
 var start = time.Date(2019, time.May, 3, 0, 0, 0, 0, time.UTC)
+
+func TestNewParser(t *testing.T) {
+	parser, err := newParser("common", "", "", time.Second)
+	require.NoError(t, err)
+	require.IsType(t, &accessmon.W3CParser{}, parser)
+
+	parser, err = newParser("combined", "", "", time.Second)
+	require.NoError(t, err)
+	require.IsType(t, &accessmon.CombinedParser{}, parser)
+
+	parser, err = newParser("elb", "", "", time.Second)
+	require.NoError(t, err)
+	require.IsType(t, &accessmon.ELBParser{}, parser)
+
+	parser, err = newParser("w3c_extended", "", "", time.Second)
+	require.NoError(t, err)
+	require.IsType(t, &accessmon.W3CExtendedParser{}, parser)
+
+	parser, err = newParser("%h %l %u %t \"%r\" %>s %b", "", "", time.Second)
+	require.NoError(t, err)
+	require.IsType(t, &accessmon.FormatParser{}, parser)
+
+	parser, err = newParser("$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent", "", "", time.Second)
+	require.NoError(t, err)
+	require.IsType(t, &accessmon.FormatParser{}, parser)
+
+	parser, err = newParser("json", defaultJSONFields, "", time.Second)
+	require.NoError(t, err)
+	require.IsType(t, &accessmon.JSONParser{}, parser)
+
+	_, err = newParser("json", "code=status", "", time.Second)
+	require.Error(t, err)
+
+	_, err = newParser("invalid", "", "", time.Second)
+	require.Error(t, err)
+
+	_, err = newParser("%h %l %u", "", "", time.Second)
+	require.Error(t, err)
+}
+
+func TestJSONFieldsFlag(t *testing.T) {
+	fields, err := jsonFieldsFlag("time=ts, source_ip=request.remote_ip,code=status")
+	require.NoError(t, err)
+	require.Equal(t, "ts", fields.Time)
+	require.Equal(t, "request.remote_ip", fields.SourceIP)
+	require.Equal(t, "status", fields.Code)
+	require.Equal(t, "", fields.User)
+
+	_, err = jsonFieldsFlag("time")
+	require.Error(t, err)
+
+	_, err = jsonFieldsFlag("invalid=ts")
+	require.Error(t, err)
+}
+
+func TestAlertMessages(t *testing.T) {
+	alert := &accessmon.Alert{Metric: accessmon.MetricRequestRate, Start: start, Value: 12.5}
+	require.Contains(t, alertStartMessage(alert), "High traffic above threshold")
+	require.Contains(t, alertStartMessage(alert), "12.500 requests per second")
+
+	alert = &accessmon.Alert{Metric: accessmon.MetricLatency, Start: start, End: start.Add(time.Minute), Value: 0.25, Percentile: 95}
+	require.Contains(t, alertStartMessage(alert), "High latency above threshold")
+	require.Contains(t, alertStartMessage(alert), "( p95 250ms )")
+	require.Contains(t, alertEndMessage(alert), "Alert duration 1m0s")
+
+	alert = &accessmon.Alert{Metric: accessmon.MetricErrorRate, Start: start, Value: 42}
+	require.Contains(t, alertStartMessage(alert), "High error rate above threshold")
+	require.Contains(t, alertStartMessage(alert), "42.0% errors")
+
+	alert = &accessmon.Alert{Rule: "api", Severity: "critical", Metric: accessmon.MetricRequestRate, Start: start, End: start.Add(time.Minute), Value: 12.5}
+	require.True(t, strings.HasSuffix(alertStartMessage(alert), " [api/critical]"))
+	require.True(t, strings.HasSuffix(alertEndMessage(alert), " [api/critical]"))
+
+	alert = &accessmon.Alert{Rule: "high_section_traffic", Metric: accessmon.MetricRequestRate, Section: "/api", Start: start, Value: 12.5}
+	require.Contains(t, alertStartMessage(alert), "High traffic on /api above threshold")
+
+	alert = &accessmon.Alert{Metric: accessmon.MetricRequestRate, Baseline: true, Start: start, Value: 4.25}
+	require.Contains(t, alertStartMessage(alert), "4.2 standard deviations above baseline")
+}
+
+func TestStringsFlag(t *testing.T) {
+	var values stringsFlag
+	require.NoError(t, values.Set("http://localhost/a"))
+	require.NoError(t, values.Set("http://localhost/b"))
+	require.Equal(t, stringsFlag{"http://localhost/a", "http://localhost/b"}, values)
+	require.Equal(t, "http://localhost/a,http://localhost/b", values.String())
+}
+
+func TestTagsFlag(t *testing.T) {
+	tags, err := tagsFlag("host=www1, env=prod,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"host": "www1", "env": "prod"}, tags)
+
+	tags, err = tagsFlag("")
+	require.NoError(t, err)
+	require.Len(t, tags, 0)
+
+	_, err = tagsFlag("host")
+	require.Error(t, err)
+}
+
+func TestSMTPPassword(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "password_")
+	require.NoError(t, err)
+	defer func() {
+		_ = tmpfile.Close()
+		_ = os.Remove(tmpfile.Name())
+	}()
+	_, err = tmpfile.WriteString("secret\n")
+	require.NoError(t, err)
+
+	password, err := smtpPassword(tmpfile.Name())
+	require.NoError(t, err)
+	require.Equal(t, "secret", password)
+
+	require.NoError(t, os.Setenv(smtpPasswordEnv, "env_secret"))
+	defer func() {
+		_ = os.Unsetenv(smtpPasswordEnv)
+	}()
+	password, err = smtpPassword("")
+	require.NoError(t, err)
+	require.Equal(t, "env_secret", password)
+
+	_, err = smtpPassword("invalid_file_name")
+	require.Error(t, err)
+}
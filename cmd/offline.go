@@ -24,14 +24,16 @@ func catLogFile(path string, mon *accessmon.Monitor) (err error) {
 
 		// Add to the monitor
 
-		alert, err := mon.AddLine(scanner.Text())
+		// invalid lines are counted by the monitor and reported at the end
+
+		alerts, err := mon.AddLine(scanner.Text())
 		if err != nil {
 			continue
 		}
 
-		// Display alert if any
+		// Display alerts if any
 
-		if alert != nil {
+		for _, alert := range alerts {
 			displayAlertOffline(alert)
 		}
 	}
@@ -68,7 +68,8 @@ func TestOffline1(t *testing.T) {
 	require.NoError(t, err)
 
 	config := &accessmon.Config{AlertWindow: 5 * time.Second, AlertThreshold: 10}
-	mon := accessmon.NewMonitor(config)
+	mon, err := accessmon.NewMonitor(config)
+	require.NoError(t, err)
 
 	err = catLogFile(tmpfile.Name(), mon)
 	require.NoError(t, err)
@@ -135,7 +136,8 @@ func TestOffline2(t *testing.T) {
 	require.NoError(t, err)
 
 	config := &accessmon.Config{AlertWindow: 5 * time.Second, AlertThreshold: 10}
-	mon := accessmon.NewMonitor(config)
+	mon, err := accessmon.NewMonitor(config)
+	require.NoError(t, err)
 
 	err = catLogFile(tmpfile.Name(), mon)
 	require.NoError(t, err)
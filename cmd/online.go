@@ -1,16 +1,65 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"math"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/camathieu/accessmon"
 	"github.com/hpcloud/tail"
 )
 
-func tailLogFile(path string, refreshInterval time.Duration, mon *accessmon.Monitor) (shutdown func(), err error) {
+// pushTop is the number of top sections pushed to the metrics backends
+const pushTop = 10
+
+// readDirectives feeds the parser with the directive lines of the log file
+// ( like the W3C Extended #Fields ) so that a stateful parser can parse the lines tailed from its end
+func readDirectives(path string, parser accessmon.Parser) (err error) {
+
+	// Open file
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Parse the directive lines only, invalid directives are reported by the monitor later on
+	// Lines longer than the buffer are read in chunks and skipped as they can't be directives
+
+	reader := bufio.NewReader(file)
+	lineStart := true
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if lineStart && err != bufio.ErrBufferFull && bytes.HasPrefix(chunk, []byte("#")) {
+			_, _ = parser.Parse(string(chunk))
+		}
+		lineStart = err != bufio.ErrBufferFull
+
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// hasDirectives returns whether the parser state depends on the directive lines of the log file
+func hasDirectives(parser accessmon.Parser) bool {
+	_, ok := parser.(*accessmon.W3CExtendedParser)
+	return ok
+}
+
+// tailLogFile follows the log file, calls display and pushes the stats on each refresh interval
+func tailLogFile(path string, refreshInterval time.Duration, mon *accessmon.Monitor, pushers []accessmon.StatsPusher, live accessmon.StatsPusher, display func()) (shutdown func(), err error) {
 
 	if refreshInterval <= 0 {
 		return func() {}, errors.New("missing refresh interval")
@@ -23,57 +72,118 @@ func tailLogFile(path string, refreshInterval time.Duration, mon *accessmon.Moni
 		return func() {}, err
 	}
 
+	ticker := time.NewTicker(refreshInterval)
+	done := make(chan struct{})
+
 	// Cleanup to call on exit
 
+	var once sync.Once
 	shutdown = func() {
-		_ = t.Stop()
-		t.Cleanup()
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+			_ = t.Stop()
+			t.Cleanup()
+		})
 	}
 
-	ticker := time.Tick(refreshInterval)
+	// The Monitor is safe for concurrent use so the lines are processed
+	// as they come while the display is refreshed from another goroutine
 
-	window := int(math.Max(10, float64(refreshInterval)))
+	go func() {
+		for line := range t.Lines {
+			// invalid lines are counted by the monitor and reported on the next refresh
+			_, _ = mon.AddLine(line.Text)
+		}
+	}()
 
 	go func() {
-	LOOP:
+		var pushed time.Time
 		for {
-
-			// This select statement allow everything to run in a single goroutine
-			// avoiding the need for synchronization in the accessmon package
-
 			select {
-			case <-ticker:
-				// Update display
-				cleanDisplay()
-
-				deadline := time.Now().Add(-time.Duration(window))
-				if mon.Last().After(deadline) {
-					displayStats(mon.Stats(refreshInterval, 1), mon.Last(), refreshInterval)
-				} else {
-
-					// It's important to note that this program does event time stream processing
-					// which is very well explained in this doc : https://ci.apache.org/projects/flink/flink-docs-stable/dev/event_time.html
-					// Not having received any data in the last interval does not mean there were actually no requests on the server,
-					// logs storage can just be slow (NFS mount points) for example.
-					// As we can make no assumptions on the time of the next log line we will receive
-					// It's better to display a proper warning than just updating the display with 0 request per seconds
-					// It's also more effective to change the format of the output to catch the operator eyes in case of such event
-
-					displayStats(nil, time.Now(), refreshInterval)
-				}
-
-				displayAlerts(mon.Alerts())
-			case line := <-t.Lines:
-				// Update monitor
-				if line == nil {
-					break LOOP
-				}
-
-				// just discard invalid lines
-				_, _ = mon.AddLine(line.Text)
+			case <-done:
+				return
+			case <-ticker.C:
 			}
+
+			// Update display
+			display()
+
+			// Push the stats to the metrics backends and the live stream
+			pushed = pushStats(mon, pushers, live, pushed, refreshInterval)
 		}
 	}()
 
 	return shutdown, nil
 }
+
+// pushStats pushes the stats of the requests received since the previous push and returns the time of the last one
+// The counter based backends get each request once : the pushed range goes from the previous push to the last
+// request and the rates are computed over that span. The requests logged after a push with the same time
+// as the last pushed one are not pushed. The live stream gets empty stats when no request was received
+// so that the dashboards don't keep showing the last rates
+func pushStats(mon *accessmon.Monitor, pushers []accessmon.StatsPusher, live accessmon.StatsPusher, pushed time.Time, refreshInterval time.Duration) time.Time {
+	if live != nil {
+		pushers = append(pushers[:len(pushers):len(pushers)], live)
+	}
+	if len(pushers) == 0 || mon.Last().IsZero() {
+		return pushed
+	}
+
+	since := pushed
+	if since.IsZero() {
+		since = mon.Last().Add(-refreshInterval)
+	}
+	stats, last := mon.StatsSince(since, pushTop)
+
+	window := last.Sub(since)
+	if window <= 0 {
+		if live != nil {
+			push(live, &accessmon.Stats{}, last, refreshInterval)
+		}
+		return pushed
+	}
+
+	// The requests older than the store window are already gone
+
+	if storeWindow := mon.StoreWindow(); storeWindow > 0 && window > storeWindow {
+		window = storeWindow
+	}
+	for _, pusher := range pushers {
+		push(pusher, stats, last, window)
+	}
+	return last
+}
+
+// push sends the stats to a metrics backend and reports the failures
+func push(pusher accessmon.StatsPusher, stats *accessmon.Stats, now time.Time, window time.Duration) {
+	if err := pusher.Push(stats, now, window); err != nil {
+		// Not on stdout where it would break the display
+		fmt.Fprintf(os.Stderr, "Warning : unable to push metrics : %s\n", err)
+	}
+}
+
+// displayRefresh prints the stats and the alerts of the refresh interval
+func displayRefresh(mon *accessmon.Monitor, refreshInterval time.Duration) {
+	cleanDisplay()
+
+	window := int(math.Max(10, float64(refreshInterval)))
+	deadline := time.Now().Add(-time.Duration(window))
+	if mon.Last().After(deadline) {
+		displayStats(mon.Stats(refreshInterval, 1), mon.Last(), refreshInterval)
+	} else {
+
+		// It's important to note that this program does event time stream processing
+		// which is very well explained in this doc : https://ci.apache.org/projects/flink/flink-docs-stable/dev/event_time.html
+		// Not having received any data in the last interval does not mean there were actually no requests on the server,
+		// logs storage can just be slow (NFS mount points) for example.
+		// As we can make no assumptions on the time of the next log line we will receive
+		// It's better to display a proper warning than just updating the display with 0 request per seconds
+		// It's also more effective to change the format of the output to catch the operator eyes in case of such event
+
+		displayStats(nil, time.Now(), refreshInterval)
+	}
+
+	displayErrors(mon)
+	displayAlerts(mon.Alerts())
+}
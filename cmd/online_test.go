@@ -4,6 +4,8 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -39,9 +41,10 @@ func TestOnlineStreamTime(t *testing.T) {
 	}()
 
 	config := &accessmon.Config{AlertWindow: 5 * time.Second, AlertThreshold: 10}
-	mon := accessmon.NewMonitor(config)
+	mon, err := accessmon.NewMonitor(config)
+	require.NoError(t, err)
 
-	shutdown, err := tailLogFile(tmpfile.Name(), 5*time.Second, mon)
+	shutdown, err := tailLogFile(tmpfile.Name(), 5*time.Second, mon, nil, nil, func() { displayRefresh(mon, 5*time.Second) })
 	require.NoError(t, err)
 	defer shutdown()
 
@@ -84,9 +87,10 @@ func TestOnlineRealtime(t *testing.T) {
 	}()
 
 	config := &accessmon.Config{AlertWindow: 2 * time.Second, AlertThreshold: 5}
-	mon := accessmon.NewMonitor(config)
+	mon, err := accessmon.NewMonitor(config)
+	require.NoError(t, err)
 
-	shutdown, err := tailLogFile(tmpfile.Name(), 1*time.Second, mon)
+	shutdown, err := tailLogFile(tmpfile.Name(), 1*time.Second, mon, nil, nil, func() { displayRefresh(mon, 1*time.Second) })
 	require.NoError(t, err)
 	defer shutdown()
 
@@ -137,9 +141,10 @@ func TestOnlineNoData(t *testing.T) {
 	}()
 
 	config := &accessmon.Config{AlertWindow: 5 * time.Second, AlertThreshold: 10}
-	mon := accessmon.NewMonitor(config)
+	mon, err := accessmon.NewMonitor(config)
+	require.NoError(t, err)
 
-	shutdown, err := tailLogFile(tmpfile.Name(), 1*time.Second, mon)
+	shutdown, err := tailLogFile(tmpfile.Name(), 1*time.Second, mon, nil, nil, func() { displayRefresh(mon, 1*time.Second) })
 	require.NoError(t, err)
 	defer shutdown()
 
@@ -150,8 +155,79 @@ func TestOnlineNoData(t *testing.T) {
 	require.Len(t, mon.Alerts(), 0)
 }
 
+func TestOnlineDirectives(t *testing.T) {
+
+	tmpfile, err := ioutil.TempFile("", "access.log_")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = tmpfile.Close()
+		_ = os.Remove(tmpfile.Name())
+	}()
+
+	_, err = tmpfile.WriteString("#Version: 1.0\n#Fields: date time c-ip cs-method cs-uri-stem sc-status sc-bytes\n2018-05-09 16:00:41 127.0.0.1 GET /www/index.html 200 12\n")
+	require.NoError(t, err)
+
+	parser := &accessmon.W3CExtendedParser{}
+	err = readDirectives(tmpfile.Name(), parser)
+	require.NoError(t, err)
+
+	mon, err := accessmon.NewMonitor(&accessmon.Config{StoreWindow: time.Second, Parser: parser})
+	require.NoError(t, err)
+
+	shutdown, err := tailLogFile(tmpfile.Name(), 1*time.Second, mon, nil, nil, func() {})
+	require.NoError(t, err)
+	defer shutdown()
+
+	time.Sleep(time.Second)
+
+	_, err = tmpfile.WriteString("2018-05-09 16:00:42 127.0.0.1 GET /api/user 503 12\n")
+	require.NoError(t, err)
+
+	time.Sleep(time.Second)
+
+	shutdown()
+
+	require.Equal(t, 1, mon.Lines())
+	require.Equal(t, 0, mon.Errors())
+	require.Equal(t, 1, mon.Stats(time.Second, 1).StatusClasses[5])
+}
+
+func TestReadDirectivesLongLine(t *testing.T) {
+
+	tmpfile, err := ioutil.TempFile("", "access.log_")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = tmpfile.Close()
+		_ = os.Remove(tmpfile.Name())
+	}()
+
+	// A line longer than the buffers with a # at a chunk boundary followed by the directives
+
+	long := strings.Repeat("a", 4096) + "#Fields: invalid" + strings.Repeat("a", 100000)
+	_, err = tmpfile.WriteString(long + "\n#Fields: date time c-ip cs-method cs-uri-stem sc-status sc-bytes\n")
+	require.NoError(t, err)
+
+	parser := &accessmon.W3CExtendedParser{}
+	err = readDirectives(tmpfile.Name(), parser)
+	require.NoError(t, err)
+
+	req, err := parser.Parse("2018-05-09 16:00:42 127.0.0.1 GET /api/user 503 12")
+	require.NoError(t, err)
+	require.Equal(t, "/api", req.Section)
+
+	require.True(t, hasDirectives(parser))
+	require.False(t, hasDirectives(&accessmon.W3CParser{}))
+}
+
+func TestReadDirectivesFileNotFound(t *testing.T) {
+	err := readDirectives("invalid_file_name", &accessmon.W3CExtendedParser{})
+	require.Error(t, err)
+}
+
 func TestOnlineFileNotFound(t *testing.T) {
-	_, err := tailLogFile("invalid_file_name", 0, nil)
+	_, err := tailLogFile("invalid_file_name", 0, nil, nil, nil, nil)
 	require.Error(t, err)
 }
 
@@ -164,6 +240,126 @@ func TestOnlineInvalidRefreshInterval(t *testing.T) {
 		_ = os.Remove(tmpfile.Name())
 	}()
 
-	_, err = tailLogFile(tmpfile.Name(), 0, nil)
+	_, err = tailLogFile(tmpfile.Name(), 0, nil, nil, nil, nil)
 	require.Error(t, err)
 }
+
+// recordPusher records the pushed stats
+type recordPusher struct {
+	lock    sync.Mutex
+	stats   []*accessmon.Stats
+	times   []time.Time
+	windows []time.Duration
+}
+
+func (pusher *recordPusher) Push(stats *accessmon.Stats, now time.Time, window time.Duration) error {
+	pusher.lock.Lock()
+	defer pusher.lock.Unlock()
+	pusher.stats = append(pusher.stats, stats)
+	pusher.times = append(pusher.times, now)
+	pusher.windows = append(pusher.windows, window)
+	return nil
+}
+
+func (pusher *recordPusher) Close() error {
+	return nil
+}
+
+func TestOnlinePush(t *testing.T) {
+
+	tmpfile, err := ioutil.TempFile("", "access.log_")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = tmpfile.Close()
+		_ = os.Remove(tmpfile.Name())
+	}()
+
+	mon, err := accessmon.NewMonitor(&accessmon.Config{StoreWindow: time.Second})
+	require.NoError(t, err)
+	pusher := &recordPusher{}
+
+	shutdown, err := tailLogFile(tmpfile.Name(), 1*time.Second, mon, []accessmon.StatsPusher{pusher}, nil, func() { displayRefresh(mon, 1*time.Second) })
+	require.NoError(t, err)
+	defer shutdown()
+
+	// Nothing is pushed until a request is processed
+
+	time.Sleep(1500 * time.Millisecond)
+	pusher.lock.Lock()
+	require.Len(t, pusher.stats, 0)
+	pusher.lock.Unlock()
+
+	req := &accessmon.Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: time.Now(), Method: "GET", Path: "/api/user", HTTPVersion: "HTTP/1.1", Code: 200}
+	_, err = tmpfile.WriteString(req.String() + "\n")
+	require.NoError(t, err)
+
+	// The window is pushed once even if no other request comes
+
+	time.Sleep(2500 * time.Millisecond)
+
+	shutdown()
+
+	pusher.lock.Lock()
+	defer pusher.lock.Unlock()
+	require.Len(t, pusher.stats, 1)
+	require.Equal(t, 1, pusher.stats[0].Count)
+	require.True(t, pusher.times[0].Equal(mon.Last()))
+}
+
+func TestPushStats(t *testing.T) {
+	mon, err := accessmon.NewMonitor(&accessmon.Config{StoreWindow: 10 * time.Second})
+	require.NoError(t, err)
+	pusher := &recordPusher{}
+	live := &recordPusher{}
+	pushers := []accessmon.StatsPusher{pusher}
+
+	addLines := func(offsets ...time.Duration) {
+		for _, offset := range offsets {
+			req := &accessmon.Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(offset), Method: "GET", Path: "/api/user", HTTPVersion: "HTTP/1.1", Code: 200}
+			_, err := mon.AddLine(req.String())
+			require.NoError(t, err)
+		}
+	}
+
+	// Nothing is pushed before the first request
+
+	pushed := pushStats(mon, pushers, live, time.Time{}, time.Second)
+	require.True(t, pushed.IsZero())
+	require.Len(t, pusher.stats, 0)
+	require.Len(t, live.stats, 0)
+
+	// The first push covers the refresh interval
+
+	addLines(0, 0, time.Second, time.Second)
+	pushed = pushStats(mon, pushers, live, pushed, time.Second)
+	require.True(t, start.Add(time.Second).Equal(pushed))
+	require.Len(t, pusher.stats, 1)
+	require.Equal(t, 2, pusher.stats[0].Count)
+	require.Equal(t, time.Second, pusher.windows[0])
+
+	// Without new requests only the live stream gets empty stats
+
+	pushed = pushStats(mon, pushers, live, pushed, time.Second)
+	require.Len(t, pusher.stats, 1)
+	require.Len(t, live.stats, 2)
+	require.Equal(t, 0, live.stats[1].Count)
+
+	// Lagging logs : the next push starts where the previous one ended
+
+	addLines(2*time.Second, 4*time.Second)
+	pushed = pushStats(mon, pushers, live, pushed, time.Second)
+	require.True(t, start.Add(4*time.Second).Equal(pushed))
+	require.Len(t, pusher.stats, 2)
+	require.Equal(t, 2, pusher.stats[1].Count)
+	require.Equal(t, 3*time.Second, pusher.windows[1])
+	require.True(t, pushed.Equal(pusher.times[1]))
+
+	// The window is bounded by the stored requests
+
+	addLines(30 * time.Second)
+	pushStats(mon, pushers, live, pushed, time.Second)
+	require.Len(t, pusher.stats, 3)
+	require.Equal(t, 1, pusher.stats[2].Count)
+	require.Equal(t, 10*time.Second, pusher.windows[2])
+}
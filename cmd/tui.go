@@ -0,0 +1,513 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/camathieu/accessmon"
+)
+
+// tuiMaxWindow is the largest stats window selectable in the terminal UI
+const tuiMaxWindow = 5 * time.Minute
+
+// tuiTop is the number of rows of the top N tables
+const tuiTop = 10
+
+// tuiHistorySize is the number of refresh intervals kept for the sparkline
+const tuiHistorySize = 1000
+
+// tuiWindows are the stats windows selectable in the terminal UI along with the refresh interval
+var tuiWindows = []time.Duration{10 * time.Second, 30 * time.Second, time.Minute, 2 * time.Minute, 5 * time.Minute}
+
+// tuiTables are the names of the top N tables
+var tuiTables = []string{"sections", "users", "sources"}
+
+const tuiHelp = " q quit  p pause  +/- window  tab table  s sort  ↑/↓ select  enter drill down  esc back"
+
+// ANSI escape sequences
+const (
+	ansiReset   = "\033[0m"
+	ansiBold    = "\033[1m"
+	ansiRed     = "\033[31m"
+	ansiReverse = "\033[7m"
+)
+
+// tui is the full-screen interactive terminal UI of the online mode
+// It is redrawn on each refresh and on each key press
+type tui struct {
+	lock sync.Mutex
+
+	mon     *accessmon.Monitor
+	refresh time.Duration
+	out     io.Writer
+	size    func() (width int, height int) // terminal size
+	now     func() time.Time               // wall clock
+
+	windows []time.Duration   // selectable stats windows
+	window  int               // index of the current stats window
+	paused  bool              // the snapshot is not updated on refresh
+	table   int               // index of the focused top N table
+	byKey   bool              // the top N tables are sorted by key instead of count
+	row     int               // selected row of the focused table
+	filter  *accessmon.Filter // drilled down section, user and source ( nil for the whole traffic )
+	history []float64         // request rate of each refresh interval, -1 if nothing was processed
+
+	snap *tuiSnapshot
+}
+
+// tuiSnapshot holds the data displayed by the terminal UI
+type tuiSnapshot struct {
+	last   time.Time // time of the last request processed
+	stats  *accessmon.Stats
+	alerts []*accessmon.Alert
+	lines  int
+	errors int
+}
+
+// newTUI builds a terminal UI displaying the stats of the refresh interval
+func newTUI(mon *accessmon.Monitor, refresh time.Duration, out io.Writer, size func() (int, int)) (ui *tui) {
+	ui = &tui{mon: mon, refresh: refresh, out: out, size: size, now: time.Now}
+
+	// The stats can't be computed over more than the stored requests
+
+	ui.windows = []time.Duration{refresh}
+	for _, window := range tuiWindows {
+		if window != refresh && window <= mon.StoreWindow() {
+			ui.windows = append(ui.windows, window)
+		}
+	}
+	sort.Slice(ui.windows, func(i, j int) bool { return ui.windows[i] < ui.windows[j] })
+	for i, window := range ui.windows {
+		if window == refresh {
+			ui.window = i
+		}
+	}
+
+	ui.snap = ui.snapshot()
+	return ui
+}
+
+// Tick records the request rate of the last refresh interval and redraws the screen
+func (ui *tui) Tick() {
+	ui.lock.Lock()
+	defer ui.lock.Unlock()
+
+	// As in the text display, not having processed any request during the last
+	// interval does not mean there were none, so it is shown as a gap
+
+	rate := float64(-1)
+	if ui.mon.Last().After(ui.now().Add(-ui.refresh)) {
+		rate = float64(ui.mon.FilteredStats(ui.refresh, 0, ui.filter).Count) / ui.refresh.Seconds()
+	}
+	ui.history = append(ui.history, rate)
+	if len(ui.history) > tuiHistorySize {
+		ui.history = ui.history[1:]
+	}
+
+	if !ui.paused {
+		ui.snap = ui.snapshot()
+	}
+	ui.draw()
+}
+
+// Draw redraws the screen
+func (ui *tui) Draw() {
+	ui.lock.Lock()
+	defer ui.lock.Unlock()
+
+	ui.draw()
+}
+
+// Key handles a key press and redraws the screen
+// It returns true if the key is a quit key
+func (ui *tui) Key(key string) (quit bool) {
+	ui.lock.Lock()
+	defer ui.lock.Unlock()
+
+	switch key {
+	case "q", "Q", "\x03":
+		return true
+	case "p", " ":
+		ui.paused = !ui.paused
+		if !ui.paused {
+			ui.snap = ui.snapshot()
+		}
+	case "+", "=":
+		if ui.window < len(ui.windows)-1 {
+			ui.window++
+			ui.snap = ui.snapshot()
+		}
+	case "-", "_":
+		if ui.window > 0 {
+			ui.window--
+			ui.snap = ui.snapshot()
+		}
+	case "\t":
+		ui.table = (ui.table + 1) % len(tuiTables)
+		ui.row = 0
+	case "s":
+		ui.byKey = !ui.byKey
+		ui.row = 0
+	case "\x1b[A", "k":
+		if ui.row > 0 {
+			ui.row--
+		}
+	case "\x1b[B", "j":
+		if ui.row < len(ui.rows(ui.table))-1 {
+			ui.row++
+		}
+	case "\r", "\n":
+		ui.drill()
+	case "\x1b", "\x7f", "\b":
+		if ui.filter != nil {
+			ui.filter = nil
+			ui.history = nil
+			ui.row = 0
+			ui.snap = ui.snapshot()
+		}
+	}
+
+	ui.draw()
+	return false
+}
+
+// drill restricts the display to the selected section, user or source
+func (ui *tui) drill() {
+	rows := ui.rows(ui.table)
+	if ui.row >= len(rows) {
+		return
+	}
+
+	// An empty key ( no user in the log format ) can't be filtered on
+
+	if rows[ui.row].Key == "" {
+		return
+	}
+
+	filter := &accessmon.Filter{}
+	if ui.filter != nil {
+		*filter = *ui.filter
+	}
+	switch tuiTables[ui.table] {
+	case "sections":
+		filter.Section = rows[ui.row].Key
+	case "users":
+		filter.User = rows[ui.row].Key
+	case "sources":
+		filter.Source = rows[ui.row].Key
+	}
+
+	ui.filter = filter
+	ui.history = nil
+	ui.row = 0
+	ui.snap = ui.snapshot()
+}
+
+func (ui *tui) snapshot() *tuiSnapshot {
+	return &tuiSnapshot{
+		last:   ui.mon.Last(),
+		stats:  ui.mon.FilteredStats(ui.windows[ui.window], tuiTop, ui.filter),
+		alerts: ui.mon.Alerts(),
+		lines:  ui.mon.Lines(),
+		errors: ui.mon.Errors(),
+	}
+}
+
+// rows returns the rows of the top N table in the display order
+func (ui *tui) rows(table int) (rows []*accessmon.CounterValue) {
+	switch tuiTables[table] {
+	case "sections":
+		rows = append(rows, ui.snap.stats.TopSection...)
+	case "users":
+		rows = append(rows, ui.snap.stats.TopUsers...)
+	case "sources":
+		rows = append(rows, ui.snap.stats.TopSources...)
+	}
+	if ui.byKey {
+		sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	}
+	return rows
+}
+
+// draw writes the whole screen, the caller must hold the lock
+func (ui *tui) draw() {
+	width, height := ui.size()
+	lines := ui.render(width, height)
+
+	var buffer strings.Builder
+	buffer.WriteString("\033[H")
+	for i, line := range lines {
+		buffer.WriteString(line + ansiReset + "\033[K")
+		if i < len(lines)-1 {
+			buffer.WriteString("\n")
+		}
+	}
+	buffer.WriteString("\033[J")
+	_, _ = io.WriteString(ui.out, buffer.String())
+}
+
+// render builds the lines of the screen, each line is at most width columns
+func (ui *tui) render(width int, height int) (lines []string) {
+	stats := ui.snap.stats
+	window := ui.windows[ui.window]
+	add := func(line string) {
+		lines = append(lines, line)
+	}
+
+	// Header
+
+	header := fmt.Sprintf(" accessmon  %s  window %s  %d lines", ui.snap.last.Format("2006-01-02 15:04:05"), window, ui.snap.lines)
+	if ui.snap.errors > 0 {
+		header += fmt.Sprintf(" ( %d could not be processed )", ui.snap.errors)
+	}
+	if ui.filter != nil {
+		header += "  " + filterName(ui.filter)
+	}
+	if ui.paused {
+		header += "  [PAUSED]"
+	}
+	add(ansiReverse + pad(header, width))
+
+	// Request rate
+
+	max := 0.0
+	for _, rate := range ui.history {
+		if rate > max {
+			max = rate
+		}
+	}
+	add(ansiBold + pad(fmt.Sprintf(" Requests per second ( every %s, max %.1f )", ui.refresh, max), width))
+	add(" " + sparkline(ui.history, width-1))
+	if stats.Count == 0 {
+		add(pad(fmt.Sprintf(" Nothing to process in the last %s", window), width))
+	} else {
+		summary := fmt.Sprintf(" %.1f req/s  server errors %.1f%%  HTTP2 %.1f%%  IPv6 %.1f%%", perSecond(stats.Count, window), stats.ServerError, stats.HTTP2, stats.Ipv6)
+		if stats.Latency != nil {
+			summary += "  latency " + formatLatency(stats.Latency)
+		}
+		add(pad(summary, width))
+	}
+	add("")
+
+	// Status code classes
+
+	add(ansiBold + pad(" Status codes", width))
+	for class := 1; class <= 5; class++ {
+		count := stats.StatusClasses[class]
+		if class == 1 && count == 0 {
+			continue
+		}
+		percent := 0.0
+		if stats.Count > 0 {
+			percent = float64(count) * 100 / float64(stats.Count)
+		}
+		add(pad(fmt.Sprintf(" %dxx %s %5.1f%% %8d", class, bar(percent/100, width-22), percent, count), width))
+	}
+	add("")
+
+	// Top N tables side by side, or the focused one only if the terminal is too narrow
+	// The alerts get the remaining rows, at least 3
+
+	tables := []int{0, 1, 2}
+	if width < 84 {
+		tables = []int{ui.table}
+	}
+	column := width / len(tables)
+	size := 1
+	for _, table := range tables {
+		if rows := len(ui.rows(table)); rows > size {
+			size = rows
+		}
+	}
+	if size > height-len(lines)-7 {
+		size = height - len(lines) - 7
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	var title string
+	for _, table := range tables {
+		name := " Top " + tuiTables[table]
+		if ui.byKey {
+			name += " ( by key )"
+		}
+		if table == ui.table {
+			title += ansiReverse + pad(name, column) + ansiReset
+		} else {
+			title += ansiBold + pad(name, column) + ansiReset
+		}
+	}
+	add(title)
+	for i := 0; i < size; i++ {
+		var line string
+		for _, table := range tables {
+			cell := pad("", column)
+			if rows := ui.rows(table); i < len(rows) {
+				cell = topCell(rows[i], window, column)
+			}
+			if table == ui.table && i == ui.row {
+				cell = ansiReverse + cell + ansiReset
+			}
+			line += cell
+		}
+		add(line)
+	}
+	add("")
+
+	// Alerts, the latest first
+
+	add(ansiBold + pad(" Alerts", width))
+	alerts := ui.snap.alerts
+	if len(alerts) == 0 {
+		add(pad(" No alert", width))
+	}
+	for i := len(alerts) - 1; i >= 0 && len(lines) < height-1; i-- {
+		if alerts[i].IsOngoing() {
+			add(ansiRed + pad(" "+alertStartMessage(alerts[i]), width))
+		} else {
+			add(pad(" "+alertEndMessage(alerts[i]), width))
+		}
+	}
+
+	// Footer on the last row
+
+	if len(lines) > height-1 {
+		lines = lines[:height-1]
+	}
+	for len(lines) < height-1 {
+		add("")
+	}
+	add(ansiReverse + pad(tuiHelp, width))
+
+	return lines
+}
+
+// topCell formats a top N table row in the column width
+func topCell(value *accessmon.CounterValue, window time.Duration, column int) string {
+	key := value.Key
+	if key == "" {
+		key = "-"
+	}
+	numbers := fmt.Sprintf(" %7d %7.1f/s ", value.Count, perSecond(value.Count, window))
+	return pad(" "+pad(key, column-utf8.RuneCountInString(numbers)-1)+numbers, column)
+}
+
+// filterName describes the drilled down traffic
+func filterName(filter *accessmon.Filter) string {
+	var parts []string
+	if filter.Section != "" {
+		parts = append(parts, "section "+filter.Section)
+	}
+	if filter.User != "" {
+		parts = append(parts, "user "+filter.User)
+	}
+	if filter.Source != "" {
+		parts = append(parts, "source "+filter.Source)
+	}
+	return strings.Join(parts, ", ")
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the last values, the negative values are gaps
+func sparkline(values []float64, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+
+	max := 0.0
+	for _, value := range values {
+		if value > max {
+			max = value
+		}
+	}
+
+	var line []rune
+	for _, value := range values {
+		switch {
+		case value < 0:
+			line = append(line, ' ')
+		case max == 0:
+			line = append(line, sparks[0])
+		default:
+			line = append(line, sparks[int(value/max*float64(len(sparks)-1)+0.5)])
+		}
+	}
+	return pad(string(line), width)
+}
+
+// bar draws a horizontal bar filled to the fraction
+func bar(fraction float64, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	filled := int(fraction*float64(width) + 0.5)
+	if filled > width {
+		filled = width
+	}
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
+
+// pad truncates or pads the text with spaces to the width
+func pad(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	count := utf8.RuneCountInString(text)
+	if count > width {
+		return string([]rune(text)[:width])
+	}
+	return text + strings.Repeat(" ", width-count)
+}
+
+// startTUI switches the terminal to raw mode and to the alternate screen
+// The returned function restores the terminal
+func startTUI(ui *tui) (stop func(), err error) {
+	restore, err := makeRaw(os.Stdin.Fd())
+	if err != nil {
+		return nil, fmt.Errorf("the terminal UI requires a terminal : %s", err)
+	}
+	fmt.Fprint(ui.out, "\033[?1049h\033[?25l")
+
+	// Redraw as soon as the terminal is resized
+
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	go func() {
+		for range resize {
+			ui.Draw()
+		}
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			fmt.Fprint(ui.out, "\033[?25h\033[?1049l")
+			restore()
+		})
+	}
+
+	ui.Draw()
+	return stop, nil
+}
+
+// readKeys handles the key presses until a quit key or the end of the input
+func (ui *tui) readKeys(in io.Reader) {
+	buffer := make([]byte, 16)
+	for {
+		n, err := in.Read(buffer)
+		if err != nil || ui.Key(string(buffer[:n])) {
+			return
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/camathieu/accessmon"
+	"github.com/stretchr/testify/require"
+)
+
+// tuiMonitor returns a Monitor fed with a test log of 10s of traffic :
+// two /api/user 200 requests from mary and one /www 404 request from john each second
+func tuiMonitor(t *testing.T) *accessmon.Monitor {
+	tmpfile, err := ioutil.TempFile("", "access.log_")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(tmpfile.Name())
+	}()
+
+	for i := 0; i < 10; i++ {
+		date := start.Add(time.Duration(i) * time.Second).Format("02/Jan/2006:15:04:05 -0700")
+		_, err = fmt.Fprintf(tmpfile, "127.0.0.1 - mary [%s] \"GET /api/user HTTP/1.1\" 200 0\n", date)
+		require.NoError(t, err)
+		_, err = fmt.Fprintf(tmpfile, "127.0.0.1 - mary [%s] \"GET /api/user HTTP/1.1\" 200 0\n", date)
+		require.NoError(t, err)
+		_, err = fmt.Fprintf(tmpfile, "127.0.0.1 - john [%s] \"GET /www HTTP/1.1\" 404 0\n", date)
+		require.NoError(t, err)
+	}
+
+	err = tmpfile.Close()
+	require.NoError(t, err)
+
+	mon, err := accessmon.NewMonitor(&accessmon.Config{StoreWindow: tuiMaxWindow, AlertWindow: 2 * time.Second, AlertThreshold: 2})
+	require.NoError(t, err)
+
+	err = catLogFile(tmpfile.Name(), mon)
+	require.NoError(t, err)
+	return mon
+}
+
+func testTUI(mon *accessmon.Monitor, width int, height int) (ui *tui, out *bytes.Buffer) {
+	out = &bytes.Buffer{}
+	ui = newTUI(mon, 10*time.Second, out, func() (int, int) { return width, height })
+	ui.now = func() time.Time { return start.Add(10 * time.Second) }
+	return ui, out
+}
+
+// screen returns the text of the last drawn screen without the escape sequences
+func screen(out *bytes.Buffer) string {
+	text := out.String()
+	text = text[strings.LastIndex(text, "\033[H"):]
+	for _, sequence := range []string{"\033[H", "\033[J", "\033[K", ansiReset, ansiBold, ansiRed, ansiReverse} {
+		text = strings.Replace(text, sequence, "", -1)
+	}
+	return text
+}
+
+func TestTUI_Render(t *testing.T) {
+	ui, out := testTUI(tuiMonitor(t), 120, 40)
+	require.Equal(t, []time.Duration{10 * time.Second, 30 * time.Second, time.Minute, 2 * time.Minute, 5 * time.Minute}, ui.windows)
+
+	ui.Tick()
+	text := screen(out)
+	lines := strings.Split(text, "\n")
+	require.Len(t, lines, 40)
+	for _, line := range lines {
+		require.True(t, len([]rune(line)) <= 120, line)
+	}
+
+	require.Contains(t, lines[0], "window 10s  30 lines")
+	require.Contains(t, text, " 3.0 req/s  server errors 0.0%")
+	require.Contains(t, text, "█")
+	require.Contains(t, text, " 2xx ")
+	require.Contains(t, text, " 66.7%       20")
+	require.Contains(t, text, " 4xx ")
+	require.Contains(t, text, " Top sections")
+	require.Contains(t, text, " /api")
+	require.Contains(t, text, " john")
+	require.Contains(t, text, " 127.0.0.1")
+	require.Contains(t, text, "AL - High traffic above threshold")
+	require.Contains(t, lines[39], "q quit")
+}
+
+func TestTUI_Keys(t *testing.T) {
+	mon := tuiMonitor(t)
+	ui, out := testTUI(mon, 120, 40)
+
+	// Window
+
+	require.False(t, ui.Key("+"))
+	require.Contains(t, screen(out), "window 30s")
+	ui.Key("-")
+	ui.Key("-")
+	require.Contains(t, screen(out), "window 10s")
+
+	// Sort and select
+
+	ui.Key("s")
+	require.Contains(t, screen(out), "Top sections ( by key )")
+	require.Equal(t, "/api", ui.rows(0)[0].Key)
+	ui.Key("\x1b[B")
+	ui.Key("\x1b[B")
+	require.Equal(t, 1, ui.row)
+	ui.Key("\x1b[A")
+	require.Equal(t, 0, ui.row)
+
+	// Drill down into a user then back
+
+	ui.Key("\t")
+	require.Equal(t, 1, ui.table)
+	ui.Key("j")
+	ui.Key("\r")
+	require.Contains(t, screen(out), "user mary")
+	require.Equal(t, 20, ui.snap.stats.Count)
+	require.Len(t, ui.snap.stats.TopSection, 1)
+
+	ui.Key("\x1b")
+	require.Nil(t, ui.filter)
+	require.Equal(t, 30, ui.snap.stats.Count)
+
+	// Pause
+
+	ui.Key("p")
+	req := &accessmon.Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(10 * time.Second), Method: "GET", Path: "/api", HTTPVersion: "HTTP/1.1", Code: 200}
+	_, err := mon.AddLine(req.String())
+	require.NoError(t, err)
+	ui.Tick()
+	require.Contains(t, screen(out), "[PAUSED]")
+	require.Contains(t, screen(out), "30 lines")
+
+	ui.Key(" ")
+	require.Contains(t, screen(out), "31 lines")
+
+	require.True(t, ui.Key("q"))
+	require.True(t, ui.Key("\x03"))
+}
+
+func TestTUI_DrillEmptyKey(t *testing.T) {
+	mon := tuiMonitor(t)
+	ui, _ := testTUI(mon, 120, 40)
+
+	ui.table = 1
+	ui.snap.stats.TopUsers = []*accessmon.CounterValue{{Key: "", Count: 10}}
+	ui.drill()
+	require.Nil(t, ui.filter)
+}
+
+func TestTUI_Narrow(t *testing.T) {
+	ui, out := testTUI(tuiMonitor(t), 60, 10)
+	ui.Tick()
+
+	lines := strings.Split(screen(out), "\n")
+	require.Len(t, lines, 10)
+	require.Contains(t, lines[9], "q quit")
+	for _, line := range lines {
+		require.True(t, len([]rune(line)) <= 60, line)
+	}
+}
+
+func TestTUI_Stale(t *testing.T) {
+	ui, out := testTUI(tuiMonitor(t), 120, 40)
+	ui.Tick()
+	ui.now = func() time.Time { return start.Add(time.Hour) }
+	ui.Tick()
+
+	require.Equal(t, []float64{3, -1}, ui.history)
+	require.Contains(t, screen(out), "max 3.0")
+}
+
+func TestSparkline(t *testing.T) {
+	require.Equal(t, "▁▅█ ▁  ", sparkline([]float64{0, 5, 10, -1, 0}, 7))
+	require.Equal(t, "▅█", sparkline([]float64{0, 5, 10}, 2))
+	require.Equal(t, "▁▁", sparkline([]float64{0, 0}, 2))
+	require.Equal(t, "", sparkline([]float64{1}, 0))
+}
+
+func TestBar(t *testing.T) {
+	require.Equal(t, "█████░░░░░", bar(0.5, 10))
+	require.Equal(t, "░░░░", bar(0, 4))
+	require.Equal(t, "████", bar(1.5, 4))
+}
+
+func TestPad(t *testing.T) {
+	require.Equal(t, "ab  ", pad("ab", 4))
+	require.Equal(t, "▁▂", pad("▁▂▃", 2))
+	require.Equal(t, "", pad("ab", -1))
+}
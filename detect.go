@@ -0,0 +1,46 @@
+package accessmon
+
+import (
+	"errors"
+)
+
+// ParserCandidate is a named Parser factory used for log format detection
+type ParserCandidate struct {
+	Name string
+	New  func() (Parser, error)
+}
+
+// DetectParser tries each candidate on the sample lines and returns the one with the best parse success rate
+// Candidates are tried in order and the first one wins in case of a tie
+func DetectParser(lines []string, candidates []*ParserCandidate) (best *ParserCandidate, rate float64, err error) {
+	if len(lines) == 0 {
+		return nil, 0, errors.New("unable to detect log format : no line to sample")
+	}
+
+	for _, candidate := range candidates {
+		// Parsers might be stateful so each candidate gets a fresh instance
+		parser, err := candidate.New()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		success := 0
+		for _, line := range lines {
+			_, err := parser.Parse(line)
+			if err == nil {
+				success++
+			}
+		}
+
+		r := float64(success) / float64(len(lines))
+		if r > rate {
+			best, rate = candidate, r
+		}
+	}
+
+	if best == nil {
+		return nil, 0, errors.New("unable to detect log format : no candidate matches")
+	}
+
+	return best, rate, nil
+}
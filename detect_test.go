@@ -0,0 +1,61 @@
+package accessmon
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newTestCandidates() []*ParserCandidate {
+	return []*ParserCandidate{
+		{Name: "common", New: func() (Parser, error) { return &W3CParser{}, nil }},
+		{Name: "combined", New: func() (Parser, error) { return &CombinedParser{}, nil }},
+		{Name: "json", New: func() (Parser, error) { return NewJSONParser(&JSONFields{Time: "time"}, "") }},
+	}
+}
+
+func TestDetectParser(t *testing.T) {
+	lines := []string{
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12 \"-\" \"curl/7.64.0\"",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12 \"-\" \"curl/7.64.0\"",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12",
+		"garbage",
+	}
+
+	candidate, rate, err := DetectParser(lines, newTestCandidates())
+	require.NoError(t, err)
+	require.Equal(t, "combined", candidate.Name)
+	require.Equal(t, 0.5, rate)
+
+	lines = []string{
+		`{"time":"2018-05-09T16:00:42+00:00"}`,
+	}
+
+	candidate, rate, err = DetectParser(lines, newTestCandidates())
+	require.NoError(t, err)
+	require.Equal(t, "json", candidate.Name)
+	require.Equal(t, float64(1), rate)
+}
+
+func TestDetectParserTie(t *testing.T) {
+	lines := []string{"garbage", "127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12"}
+
+	candidates := newTestCandidates()
+	candidates = append(candidates, &ParserCandidate{Name: "common2", New: candidates[0].New})
+
+	candidate, _, err := DetectParser(lines, candidates)
+	require.NoError(t, err)
+	require.Equal(t, "common", candidate.Name)
+}
+
+func TestDetectParserError(t *testing.T) {
+	_, _, err := DetectParser(nil, newTestCandidates())
+	require.Error(t, err)
+
+	_, _, err = DetectParser([]string{"garbage"}, newTestCandidates())
+	require.Error(t, err)
+
+	candidates := []*ParserCandidate{{Name: "invalid", New: func() (Parser, error) { return nil, errors.New("invalid") }}}
+	_, _, err = DetectParser([]string{"garbage"}, candidates)
+	require.Error(t, err)
+}
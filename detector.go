@@ -0,0 +1,199 @@
+package accessmon
+
+import (
+	"sort"
+	"time"
+)
+
+// Detector detects anomalies in the request stream and raises alerts
+// Custom Detectors can be registered with Config.Detectors or Monitor.AddDetector
+// The Monitor never runs Detect concurrently with another call but Alerts may be called
+// concurrently with other Alerts calls, so Alerts must only read the Detector state
+type Detector interface {
+	// Window returns the time window of requests the Detector needs
+	Window() time.Duration
+
+	// Detect is called for each new request with the requests received during the window
+	// ( the new request included ). It returns the alerts that did start or end
+	// The window slice is only valid during the call and must not be modified
+	Detect(req *Request, window []*Request) (alerts []*Alert)
+
+	// Alerts returns all alerts previously issued by the Detector
+	Alerts() (alerts []*Alert)
+}
+
+// ruleDetector is the Detector of a Rule. It feeds an Alerter with a metric computed
+// over the filtered requests of its sliding window
+// Per section rules run one Alerter for each section seen in the window
+type ruleDetector struct {
+	rule      *Rule
+	metric    metric
+	alerter   *Alerter             // global Alerter
+	sections  map[string]*Alerter  // per section Alerters
+	baselines map[string]*Baseline // global or per section Baselines of the baseline rules
+
+	alerts []*Alert  // alerts issued by the removed per section Alerters
+	swept  time.Time // time of the last sweep of the idle per section Baselines
+
+	latency map[string]latencySample // last global or per section latency of the latency rules
+}
+
+// latencySample is a latency percentile computed at a given time
+type latencySample struct {
+	time  time.Time
+	value float64
+}
+
+// baselineIdleWindows is the number of windows without traffic after which a per section Baseline is forgotten
+const baselineIdleWindows = 100
+
+// latencyRefreshes is the number of times per window the latency percentile is computed
+// Sorting the window for each request would be too costly so the last value is reused in between
+const latencyRefreshes = 100
+
+// NewRuleDetector builds the Detector of a rule
+func NewRuleDetector(rule *Rule) (detector Detector, err error) {
+	err = rule.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// The zero parameters of the rules built programmatically stand for the defaults
+
+	defaults := *rule
+	defaults.setDefaults()
+	rule = &defaults
+
+	// The source filter is parsed once into a copy owned by the Detector
+
+	if rule.Filter != nil {
+		filter := *rule.Filter
+		filter.network, _ = filter.source()
+		rule.Filter = &filter
+	}
+
+	d := &ruleDetector{rule: rule, metric: rule.metric()}
+	if rule.Baseline != nil {
+		d.baselines = make(map[string]*Baseline)
+	}
+	if rule.Metric == MetricLatency {
+		d.latency = make(map[string]latencySample)
+	}
+	if rule.PerSection {
+		d.sections = make(map[string]*Alerter)
+	} else {
+		d.alerter = NewRuleAlerter(rule)
+	}
+	return d, nil
+}
+
+// Window returns the sliding window of the rule
+func (d *ruleDetector) Window() time.Duration {
+	return d.rule.Window
+}
+
+// Detect updates the Alerters with the requests of the window
+// It returns the alerts that did start or end
+func (d *ruleDetector) Detect(req *Request, requests []*Request) (alerts []*Alert) {
+	now := req.Time
+	requests = filterRequests(requests, d.rule.Filter)
+
+	if d.alerter != nil {
+		if alert := d.alerter.Check(now, d.value(now, "", requests)); alert != nil {
+			alerts = append(alerts, alert)
+		}
+		return alerts
+	}
+
+	// Group by section
+
+	groups := make(map[string][]*Request)
+	for _, req := range requests {
+		groups[req.Section] = append(groups[req.Section], req)
+	}
+	for section := range groups {
+		if _, ok := d.sections[section]; !ok {
+			d.sections[section] = NewSectionAlerter(d.rule, section)
+		}
+	}
+
+	// Sections without requests in the window are checked too so that their alerts can end
+
+	var sections []string
+	for section := range d.sections {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	for _, section := range sections {
+		alerter := d.sections[section]
+		if alert := alerter.Check(now, d.value(now, section, groups[section])); alert != nil {
+			alerts = append(alerts, alert)
+		}
+
+		// Forget idle sections to keep the number of Alerters bounded
+		// The learned Baselines are kept until they are idle for baselineIdleWindows
+
+		if len(groups[section]) == 0 && !alerter.IsOngoing() {
+			d.alerts = append(d.alerts, alerter.Alerts()...)
+			delete(d.sections, section)
+			delete(d.latency, section)
+		}
+	}
+
+	// Forget the Baselines of the long idle sections, at most once per window
+
+	if d.baselines != nil && now.Sub(d.swept) >= d.rule.Window {
+		for section, baseline := range d.baselines {
+			if _, ok := d.sections[section]; !ok && now.Sub(baseline.last) >= baselineIdleWindows*d.rule.Window {
+				delete(d.baselines, section)
+			}
+		}
+		d.swept = now
+	}
+
+	return alerts
+}
+
+// metricValue computes the metric of the requests of the section ( "" for the global one )
+// The latency percentile is only computed latencyRefreshes times per window
+func (d *ruleDetector) metricValue(now time.Time, section string, requests []*Request) float64 {
+	if d.latency == nil {
+		return d.metric(requests, d.rule.Window)
+	}
+
+	sample, ok := d.latency[section]
+	if !ok || now.Sub(sample.time) >= d.rule.Window/latencyRefreshes {
+		sample = latencySample{time: now, value: d.metric(requests, d.rule.Window)}
+		d.latency[section] = sample
+	}
+	return sample.value
+}
+
+// value computes the metric of the requests
+// For baseline rules it is the deviation from the Baseline of the section ( "" for the global one )
+func (d *ruleDetector) value(now time.Time, section string, requests []*Request) float64 {
+	value := d.metricValue(now, section, requests)
+	if d.baselines == nil {
+		return value
+	}
+
+	baseline, ok := d.baselines[section]
+	if !ok {
+		baseline = NewBaseline(d.rule.Baseline, d.rule.Window)
+		d.baselines[section] = baseline
+	}
+	return baseline.Deviation(now, value)
+}
+
+// Alerts returns all alerts previously issued for the rule
+func (d *ruleDetector) Alerts() (alerts []*Alert) {
+	if d.alerter != nil {
+		return d.alerter.Alerts()
+	}
+	alerts = append(alerts, d.alerts...)
+	for _, alerter := range d.sections {
+		alerts = append(alerts, alerter.Alerts()...)
+	}
+	return alerts
+}
@@ -0,0 +1,132 @@
+package accessmon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// ExecConfig holds the parameters of an ExecNotifier
+type ExecConfig struct {
+	Command   string        // Shell command to run
+	Timeout   time.Duration // The command is killed after the timeout ( 30s by default )
+	QueueSize int           // Maximum number of pending events, new events are dropped when full ( 100 by default )
+	Logger    *log.Logger   // Logger for the failed commands ( standard logger by default )
+}
+
+// Default ExecConfig parameters
+const (
+	defaultExecTimeout   = 30 * time.Second
+	defaultExecQueueSize = 100
+)
+
+// ExecNotifier runs a shell command when alerts start or end
+// The alert details are provided as ACCESSMON_* environment variables and as a JSON AlertEvent on stdin
+// Commands are run one at a time by a background goroutine from a bounded queue
+type ExecNotifier struct {
+	*asyncNotifier
+
+	config *ExecConfig
+}
+
+// NewExecNotifier builds an ExecNotifier and starts its background goroutine
+func NewExecNotifier(config *ExecConfig) (notifier *ExecNotifier) {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultExecTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultExecQueueSize
+	}
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	notifier = &ExecNotifier{config: config}
+	notifier.asyncNotifier = newAsyncNotifier(config.QueueSize, 0, notifier.run)
+
+	return notifier
+}
+
+// run runs the command for each event and logs the failures
+func (notifier *ExecNotifier) run(events []*AlertEvent) {
+	for _, event := range events {
+		err := notifier.exec(event)
+		if err != nil {
+			notifier.config.Logger.Printf("alert exec %q : %s", notifier.config.Command, err)
+		}
+	}
+}
+
+func (notifier *ExecNotifier) exec(event *AlertEvent) (err error) {
+	stdin, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// The command is killed on timeout or when the notifier is closed and out of time
+
+	ctx, cancel := context.WithTimeout(notifier.ctx, notifier.config.Timeout)
+	defer cancel()
+
+	// The output goes to a file rather than a pipe so that the children
+	// of a killed shell still holding it open don't block Wait
+
+	output, err := ioutil.TempFile("", "accessmon_exec_")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = output.Close()
+		_ = os.Remove(output.Name())
+	}()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", notifier.config.Command)
+	cmd.Env = append(os.Environ(), eventEnv(event)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timeout after %s", notifier.config.Timeout)
+	}
+	if notifier.ctx.Err() != nil {
+		return fmt.Errorf("killed on close")
+	}
+	if err != nil {
+		message, _ := ioutil.ReadFile(output.Name())
+		if len(bytes.TrimSpace(message)) == 0 {
+			return err
+		}
+		return fmt.Errorf("%s : %s", err, bytes.TrimSpace(message))
+	}
+
+	return nil
+}
+
+// eventEnv returns the environment variables describing the event
+func eventEnv(event *AlertEvent) (env []string) {
+	end := ""
+	if event.End != nil {
+		end = event.End.Format(time.RFC3339)
+	}
+	return []string{
+		"ACCESSMON_RULE=" + event.Rule,
+		"ACCESSMON_SEVERITY=" + event.Severity,
+		"ACCESSMON_METRIC=" + event.Metric,
+		"ACCESSMON_SECTION=" + event.Section,
+		"ACCESSMON_STATUS=" + event.Status,
+		"ACCESSMON_START=" + event.Start.Format(time.RFC3339),
+		"ACCESSMON_END=" + end,
+		"ACCESSMON_VALUE=" + strconv.FormatFloat(event.Value, 'f', -1, 64),
+		"ACCESSMON_DURATION=" + strconv.FormatFloat(event.Duration, 'f', -1, 64),
+		"ACCESSMON_HOST=" + event.Host,
+	}
+}
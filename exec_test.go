@@ -0,0 +1,85 @@
+package accessmon
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecNotifier_Notify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accessmon_exec_")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	notifier := NewExecNotifier(&ExecConfig{Command: "env > " + dir + "/env && cat > " + dir + "/stdin"})
+
+	alert := &Alert{Rule: "high_traffic", Severity: "critical", Metric: MetricRequestRate, Section: "/api", Start: start, End: start.Add(time.Minute), Value: 12.5}
+	notifier.Notify(alert)
+	notifier.Close()
+
+	env, err := ioutil.ReadFile(dir + "/env")
+	require.NoError(t, err)
+	require.Contains(t, string(env), "ACCESSMON_RULE=high_traffic\n")
+	require.Contains(t, string(env), "ACCESSMON_SEVERITY=critical\n")
+	require.Contains(t, string(env), "ACCESSMON_SECTION=/api\n")
+	require.Contains(t, string(env), "ACCESSMON_STATUS=closed\n")
+	require.Contains(t, string(env), "ACCESSMON_START=2019-05-03T00:00:00Z\n")
+	require.Contains(t, string(env), "ACCESSMON_END=2019-05-03T00:01:00Z\n")
+	require.Contains(t, string(env), "ACCESSMON_VALUE=12.5\n")
+	require.Contains(t, string(env), "ACCESSMON_DURATION=60\n")
+
+	stdin, err := ioutil.ReadFile(dir + "/stdin")
+	require.NoError(t, err)
+	event := &AlertEvent{}
+	require.NoError(t, json.Unmarshal(stdin, event))
+	require.Equal(t, "high_traffic", event.Rule)
+	require.Equal(t, AlertStatusClosed, event.Status)
+}
+
+func TestExecNotifier_Failure(t *testing.T) {
+	var output bytes.Buffer
+	notifier := NewExecNotifier(&ExecConfig{Command: "echo oops >&2; exit 3", Logger: log.New(&output, "", 0)})
+	notifier.Notify(&Alert{Rule: "high_traffic", Start: start})
+	notifier.Close()
+
+	require.Contains(t, output.String(), "exit status 3 : oops")
+}
+
+func TestExecNotifier_Timeout(t *testing.T) {
+	var output bytes.Buffer
+	notifier := NewExecNotifier(&ExecConfig{Command: "sleep 10", Timeout: 100 * time.Millisecond, Logger: log.New(&output, "", 0)})
+
+	now := time.Now()
+	notifier.Notify(&Alert{Rule: "high_traffic", Start: start})
+	notifier.Close()
+
+	require.True(t, time.Since(now) < 5*time.Second)
+	require.True(t, strings.Contains(output.String(), "timeout after 100ms"), output.String())
+}
+
+func TestExecNotifier_CloseTimeout(t *testing.T) {
+	var output bytes.Buffer
+	notifier := NewExecNotifier(&ExecConfig{Command: "sleep 10; sleep 10", Logger: log.New(&output, "", 0)})
+	notifier.closeTimeout = 100 * time.Millisecond
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		notifier.Notify(&Alert{Rule: "high_traffic", Start: start})
+	}
+	notifier.Close()
+
+	// The running command is killed and the pending events dropped
+
+	require.True(t, time.Since(now) < 5*time.Second)
+	require.True(t, strings.Contains(output.String(), "killed on close"), output.String())
+	require.Equal(t, 2, notifier.Dropped())
+}
@@ -0,0 +1,95 @@
+package accessmon
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// GraphiteConfig holds the parameters of a GraphitePusher
+type GraphiteConfig struct {
+	Addr    string        // Carbon plaintext TCP address host:port
+	Prefix  string        // Metric path prefix ( accessmon by default )
+	Timeout time.Duration // Connection timeout ( 10s by default )
+}
+
+// GraphitePusher writes the Stats in the Graphite plaintext protocol over TCP
+// A new connection is opened for each push so that a restarted carbon server is transparently reconnected
+// see : https://graphite.readthedocs.io/en/latest/feeding-carbon.html
+// accessmon.count 20 1556841600
+// accessmon.sections.api.count 15 1556841600
+type GraphitePusher struct {
+	config *GraphiteConfig
+}
+
+// NewGraphitePusher builds a GraphitePusher
+func NewGraphitePusher(config *GraphiteConfig) (pusher *GraphitePusher, err error) {
+	if config.Prefix == "" {
+		config.Prefix = "accessmon"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if _, _, err := net.SplitHostPort(config.Addr); err != nil {
+		return nil, err
+	}
+	return &GraphitePusher{config: config}, nil
+}
+
+// Push writes the metrics of the whole traffic and of each top section
+func (pusher *GraphitePusher) Push(stats *Stats, now time.Time, window time.Duration) (err error) {
+	conn, err := net.DialTimeout("tcp", pusher.config.Addr, pusher.config.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(pusher.config.Timeout))
+
+	_, err = conn.Write([]byte(pusher.lines(stats, now, window)))
+	return err
+}
+
+// Close does nothing as connections are opened for each push
+func (pusher *GraphitePusher) Close() error {
+	return nil
+}
+
+// lines formats the stats in the plaintext protocol
+func (pusher *GraphitePusher) lines(stats *Stats, now time.Time, window time.Duration) string {
+	var buffer bytes.Buffer
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	metric := func(path string, value float64) {
+		fmt.Fprintf(&buffer, "%s.%s %s %s\n", pusher.config.Prefix, path, strconv.FormatFloat(value, 'f', -1, 64), timestamp)
+	}
+
+	metric("count", float64(stats.Count))
+	metric("request_rate", perSecond(stats.Count, window))
+	if stats.Count > 0 {
+		metric("server_error_percent", stats.ServerError)
+		metric("http2_percent", stats.HTTP2)
+		metric("ipv6_percent", stats.Ipv6)
+	}
+	if stats.Latency != nil {
+		graphiteLatency(metric, "latency", stats.Latency)
+	}
+
+	for _, section := range stats.TopSection {
+		path := "sections." + sectionName(section.Key)
+		metric(path+".count", float64(section.Count))
+		metric(path+".request_rate", perSecond(section.Count, window))
+		if latency, ok := stats.SectionLatency[section.Key]; ok {
+			graphiteLatency(metric, path+".latency", latency)
+		}
+	}
+
+	return buffer.String()
+}
+
+func graphiteLatency(metric func(string, float64), path string, latency *Latency) {
+	metric(path+".p50", milliseconds(latency.P50))
+	metric(path+".p90", milliseconds(latency.P90))
+	metric(path+".p99", milliseconds(latency.P99))
+	metric(path+".max", milliseconds(latency.Max))
+}
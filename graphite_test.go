@@ -0,0 +1,56 @@
+package accessmon
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphitePusher_Push(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	pusher, err := NewGraphitePusher(&GraphiteConfig{Addr: listener.Addr().String()})
+	require.NoError(t, err)
+	defer pusher.Close()
+
+	require.NoError(t, pusher.Push(testStats(), start, 10*time.Second))
+
+	data := <-received
+	require.Contains(t, data, "accessmon.count 20 1556841600\n")
+	require.Contains(t, data, "accessmon.request_rate 2 1556841600\n")
+	require.Contains(t, data, "accessmon.server_error_percent 5 1556841600\n")
+	require.Contains(t, data, "accessmon.latency.max 1.5 1556841600\n")
+	require.Contains(t, data, "accessmon.sections.api.count 15 1556841600\n")
+	require.Contains(t, data, "accessmon.sections.api.latency.p99 100 1556841600\n")
+	require.Contains(t, data, "accessmon.sections.root.request_rate 0.5 1556841600\n")
+}
+
+func TestGraphitePusher_PushError(t *testing.T) {
+	_, err := NewGraphitePusher(&GraphiteConfig{Addr: "invalid"})
+	require.Error(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	pusher, err := NewGraphitePusher(&GraphiteConfig{Addr: addr, Timeout: time.Second})
+	require.NoError(t, err)
+	require.Error(t, pusher.Push(&Stats{}, start, 10*time.Second))
+}
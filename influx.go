@@ -0,0 +1,188 @@
+package accessmon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxConfig holds the parameters of an InfluxPusher
+type InfluxConfig struct {
+	URL         string            // http(s)://host:8086/write?db=accessmon or udp://host:8089
+	Token       string            // InfluxDB 2 API token sent in the Authorization header ( HTTP only )
+	Measurement string            // Measurement name prefix ( accessmon by default )
+	Tags        map[string]string // Tags added to every point
+	Timeout     time.Duration     // HTTP request timeout ( 10s by default )
+}
+
+// InfluxPusher writes the Stats as InfluxDB line protocol points over HTTP or UDP
+// see : https://docs.influxdata.com/influxdb/v1.7/write_protocols/line_protocol_reference/
+// accessmon count=20i,request_rate=2,server_error_percent=5,http2_percent=50,ipv6_percent=10 1556841600000000000
+// accessmon_section,rank=1,section=/api count=15i,request_rate=1.5 1556841600000000000
+type InfluxPusher struct {
+	config *InfluxConfig
+	client *http.Client // HTTP mode
+	conn   net.Conn     // UDP mode
+}
+
+// NewInfluxPusher builds an InfluxPusher for the HTTP or UDP URL
+func NewInfluxPusher(config *InfluxConfig) (pusher *InfluxPusher, err error) {
+	if config.Measurement == "" {
+		config.Measurement = "accessmon"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	pusher = &InfluxPusher{config: config}
+	switch u.Scheme {
+	case "http", "https":
+		pusher.client = &http.Client{Timeout: config.Timeout}
+	case "udp":
+		pusher.conn, err = net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported influxdb url scheme %q", u.Scheme)
+	}
+
+	return pusher, nil
+}
+
+// Push writes a point for the whole traffic and a point for each top section
+func (pusher *InfluxPusher) Push(stats *Stats, now time.Time, window time.Duration) (err error) {
+	body := []byte(pusher.points(stats, now, window))
+	if pusher.conn != nil {
+		_, err = pusher.conn.Write(body)
+		return err
+	}
+
+	req, err := http.NewRequest("POST", pusher.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if pusher.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+pusher.config.Token)
+	}
+
+	resp, err := pusher.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("influxdb write : unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Close closes the UDP socket
+func (pusher *InfluxPusher) Close() error {
+	if pusher.conn != nil {
+		return pusher.conn.Close()
+	}
+	return nil
+}
+
+// points formats the stats in the line protocol
+func (pusher *InfluxPusher) points(stats *Stats, now time.Time, window time.Duration) string {
+	var buffer bytes.Buffer
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	// Whole traffic
+
+	fields := []string{
+		"count=" + strconv.Itoa(stats.Count) + "i",
+		"request_rate=" + influxFloat(perSecond(stats.Count, window)),
+	}
+	if stats.Count > 0 {
+		fields = append(fields,
+			"server_error_percent="+influxFloat(stats.ServerError),
+			"http2_percent="+influxFloat(stats.HTTP2),
+			"ipv6_percent="+influxFloat(stats.Ipv6),
+		)
+	}
+	fields = append(fields, influxLatency(stats.Latency)...)
+	pusher.point(&buffer, pusher.config.Measurement, nil, fields, timestamp)
+
+	// Top sections
+
+	for i, section := range stats.TopSection {
+		fields := []string{
+			"count=" + strconv.Itoa(section.Count) + "i",
+			"request_rate=" + influxFloat(perSecond(section.Count, window)),
+		}
+		fields = append(fields, influxLatency(stats.SectionLatency[section.Key])...)
+		tags := map[string]string{"section": section.Key, "rank": strconv.Itoa(i + 1)}
+		pusher.point(&buffer, pusher.config.Measurement+"_section", tags, fields, timestamp)
+	}
+
+	return buffer.String()
+}
+
+// point writes a line protocol point with the configured tags
+func (pusher *InfluxPusher) point(buffer *bytes.Buffer, measurement string, tags map[string]string, fields []string, timestamp string) {
+	all := make(map[string]string)
+	for key, value := range pusher.config.Tags {
+		all[key] = value
+	}
+	for key, value := range tags {
+		all[key] = value
+	}
+
+	// Tags should be sorted by key for the best performance
+	var keys []string
+	for key := range all {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buffer.WriteString(influxMeasurementEscaper.Replace(measurement))
+	for _, key := range keys {
+		if all[key] == "" {
+			continue
+		}
+		buffer.WriteString("," + influxTagEscaper.Replace(key) + "=" + influxTagEscaper.Replace(all[key]))
+	}
+	buffer.WriteString(" " + strings.Join(fields, ",") + " " + timestamp + "\n")
+}
+
+func influxLatency(latency *Latency) []string {
+	if latency == nil {
+		return nil
+	}
+	return []string{
+		"latency_p50=" + influxFloat(milliseconds(latency.P50)),
+		"latency_p90=" + influxFloat(milliseconds(latency.P90)),
+		"latency_p99=" + influxFloat(milliseconds(latency.P99)),
+		"latency_max=" + influxFloat(milliseconds(latency.Max)),
+	}
+}
+
+// The line breaks are written as escape sequences so that a section from the logs can't start a new point
+// and the backslashes are doubled so that they can't escape the delimiters
+var (
+	influxMeasurementEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r", ",", "\\,", " ", "\\ ")
+	influxTagEscaper         = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r", ",", "\\,", " ", "\\ ", "=", "\\=")
+)
+
+func influxFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,92 @@
+package accessmon
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfluxPusher_PushHTTP(t *testing.T) {
+	var body, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		authorization = r.Header.Get("Authorization")
+		assert.Equal(t, "accessmon", r.URL.Query().Get("db"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	pusher, err := NewInfluxPusher(&InfluxConfig{URL: server.URL + "/write?db=accessmon", Token: "secret", Tags: map[string]string{"host": "www 1"}})
+	require.NoError(t, err)
+	defer pusher.Close()
+
+	require.NoError(t, pusher.Push(testStats(), start, 10*time.Second))
+	require.Equal(t, "Token secret", authorization)
+
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	require.Len(t, lines, 3)
+	require.Equal(t, "accessmon,host=www\\ 1 count=20i,request_rate=2,server_error_percent=5,http2_percent=50,ipv6_percent=10,"+
+		"latency_p50=10,latency_p90=50,latency_p99=100,latency_max=1.5 1556841600000000000", lines[0])
+	require.Equal(t, "accessmon_section,host=www\\ 1,rank=1,section=/api count=15i,request_rate=1.5,"+
+		"latency_p50=10,latency_p90=50,latency_p99=100,latency_max=200 1556841600000000000", lines[1])
+	require.Equal(t, "accessmon_section,host=www\\ 1,rank=2,section=/ count=5i,request_rate=0.5 1556841600000000000", lines[2])
+}
+
+func TestInfluxPusher_PushHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	pusher, err := NewInfluxPusher(&InfluxConfig{URL: server.URL + "/write?db=accessmon"})
+	require.NoError(t, err)
+
+	require.Error(t, pusher.Push(&Stats{}, start, 10*time.Second))
+}
+
+func TestInfluxPusher_PushUDP(t *testing.T) {
+	server := listenUDP(t)
+	defer server.Close()
+
+	pusher, err := NewInfluxPusher(&InfluxConfig{URL: "udp://" + server.LocalAddr().String(), Measurement: "www"})
+	require.NoError(t, err)
+	defer pusher.Close()
+
+	require.NoError(t, pusher.Push(&Stats{}, start, 10*time.Second))
+
+	lines := readUDP(t, server)
+	require.Equal(t, []string{"www count=0i,request_rate=0 1556841600000000000", ""}, lines)
+}
+
+func TestInfluxPusher_PushEscape(t *testing.T) {
+	server := listenUDP(t)
+	defer server.Close()
+
+	pusher, err := NewInfluxPusher(&InfluxConfig{URL: "udp://" + server.LocalAddr().String(), Measurement: "www"})
+	require.NoError(t, err)
+	defer pusher.Close()
+
+	// A section from the logs must not forge a point
+
+	stats := &Stats{TopSection: []*CounterValue{{Key: "/a\\\nforged count=1i 0", Count: 1}}}
+	require.NoError(t, pusher.Push(stats, start, 10*time.Second))
+
+	lines := readUDP(t, server)
+	require.Len(t, lines, 3)
+	require.Equal(t, `www_section,rank=1,section=/a\\\nforged\ count\=1i\ 0 count=1i,request_rate=0.1 1556841600000000000`, lines[1])
+}
+
+func TestNewInfluxPusher_Error(t *testing.T) {
+	_, err := NewInfluxPusher(&InfluxConfig{URL: "tcp://localhost:8086"})
+	require.Error(t, err)
+
+	_, err = NewInfluxPusher(&InfluxConfig{URL: ":invalid"})
+	require.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package accessmon
+
+import (
+	"sort"
+	"time"
+)
+
+// metric computes the value watched by an Alerter from the requests of the sliding window
+type metric func(requests []*Request, window time.Duration) float64
+
+// requestRate returns the number of requests per second
+func requestRate(requests []*Request, window time.Duration) float64 {
+	return float64(len(requests)) / float64(window.Seconds())
+}
+
+// latencyPercentileMetric returns the p percentile of the requests duration in seconds
+func latencyPercentileMetric(p float64) metric {
+	return func(requests []*Request, window time.Duration) float64 {
+		return latencyPercentile(requests, p).Seconds()
+	}
+}
+
+// errorRateMetric returns the percentage of responses in the status code class ( 5 for 5xx )
+// It returns 0 if there are less than minRequests requests to avoid flapping on low traffic
+func errorRateMetric(class int, minRequests int) metric {
+	return func(requests []*Request, window time.Duration) float64 {
+		if len(requests) == 0 || len(requests) < minRequests {
+			return 0
+		}
+		errors := 0
+		for _, req := range requests {
+			if req.CodeClass() == class {
+				errors++
+			}
+		}
+		return float64(errors) / float64(len(requests)) * 100
+	}
+}
+
+// latencyPercentile returns the percentile of the duration of the requests
+// It returns 0 if no request has a known duration
+func latencyPercentile(requests []*Request, p float64) time.Duration {
+	var durations []time.Duration
+	for _, req := range requests {
+		if req.HasDuration {
+			durations = append(durations, req.Duration)
+		}
+	}
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return percentile(durations, p)
+}
@@ -0,0 +1,36 @@
+package accessmon
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLatencyPercentile(t *testing.T) {
+	require.Equal(t, time.Duration(0), latencyPercentile(nil, 95))
+	require.Equal(t, time.Duration(0), latencyPercentile([]*Request{{Duration: time.Second}}, 95))
+
+	requests := []*Request{
+		{Duration: 3 * time.Second, HasDuration: true},
+		{Duration: time.Second, HasDuration: true},
+		{Duration: 2 * time.Second, HasDuration: true},
+		{Duration: time.Hour},
+	}
+	require.Equal(t, 2*time.Second, latencyPercentile(requests, 50))
+	require.Equal(t, 3*time.Second, latencyPercentile(requests, 95))
+}
+
+func TestRequestRate(t *testing.T) {
+	requests := make([]*Request, 30)
+	require.Equal(t, float64(0), requestRate(nil, 10*time.Second))
+	require.Equal(t, float64(3), requestRate(requests, 10*time.Second))
+}
+
+func TestErrorRateMetric(t *testing.T) {
+	requests := []*Request{{Code: 200}, {Code: 404}, {Code: 500}, {Code: 503}}
+
+	require.Equal(t, float64(0), errorRateMetric(5, 0)(nil, time.Second))
+	require.Equal(t, float64(50), errorRateMetric(5, 0)(requests, time.Second))
+	require.Equal(t, float64(25), errorRateMetric(4, 4)(requests, time.Second))
+	require.Equal(t, float64(0), errorRateMetric(5, 5)(requests, time.Second))
+}
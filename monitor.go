@@ -1,6 +1,8 @@
 package accessmon
 
 import (
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -9,62 +11,219 @@ type Config struct {
 	StoreWindow    time.Duration // Time window of parsed lines to keep in-memory
 	AlertWindow    time.Duration // Sliding window parameter of the Alerter
 	AlertThreshold float64       // Threshold parameter of the Alerter
+	Parser         Parser        // Parser to parse log entries ( W3CParser by default )
+
+	AlertClearWindow    time.Duration // Sliding window parameter to clear an alert of the Alerter ( AlertWindow by default )
+	AlertClearThreshold float64       // Threshold parameter to clear an alert of the Alerter ( AlertThreshold by default )
+
+	LatencyAlertWindow         time.Duration // Sliding window parameter of the latency Alerter
+	LatencyAlertThreshold      time.Duration // p95 latency threshold parameter of the latency Alerter
+	LatencyAlertClearWindow    time.Duration // Sliding window parameter to clear an alert of the latency Alerter ( LatencyAlertWindow by default )
+	LatencyAlertClearThreshold time.Duration // p95 latency threshold parameter to clear an alert of the latency Alerter ( LatencyAlertThreshold by default )
+
+	ErrorAlertWindow         time.Duration // Sliding window parameter of the error rate Alerter
+	ErrorAlertThreshold      float64       // Error percentage threshold parameter of the error rate Alerter
+	ErrorAlertClearWindow    time.Duration // Sliding window parameter to clear an alert of the error rate Alerter ( ErrorAlertWindow by default )
+	ErrorAlertClearThreshold float64       // Error percentage threshold parameter to clear an alert of the error rate Alerter ( ErrorAlertThreshold by default )
+	ErrorAlertClass          int           // Status code class watched by the error rate Alerter ( 5 for 5xx by default )
+	ErrorAlertMinRequests    int           // Minimum number of requests in the window for the error rate Alerter to trigger
+
+	SectionAlertWindow    time.Duration // Sliding window parameter of the per section Alerters
+	SectionAlertThreshold float64       // Threshold parameter of the per section Alerters
+
+	BaselineAlertWindow    time.Duration // Sliding window and sampling interval of the baseline Alerter
+	BaselineAlertThreshold float64       // Number of standard deviations above the learned request rate baseline to alert
+	BaselineAlertSeasonal  bool          // Learn a distinct baseline for each hour of the week
+
+	Rules     []*Rule    // Additional alerting rules
+	Detectors []Detector // Custom anomaly Detectors
+	Notifiers []Notifier // Notifiers to send the alerts to when they start or end
+	Observers []Observer // Observers of every processed line
+}
+
+// Observer is notified of every line processed by the Monitor
+type Observer interface {
+	// Observe is called with the parsed request or with the error if the line could not be processed
+	// Both are nil for the lines that don't hold a request ( like W3C Extended directives )
+	Observe(req *Request, err error)
 }
 
+// latencyAlertPercentile is the percentile watched by the latency Alerter
+const latencyAlertPercentile = 95
+
 // Monitor holds the different components to analyse a W3C Common Log File line stream
-// /!\ NOT THREAD SAFE /!\
+// It is safe for concurrent use : lines from several inputs are processed one at a time
+// while the statistics and the alerts can be queried concurrently
 type Monitor struct {
-	config  *Config  // Monitoring configuration
-	parser  Parser   // Parser to parse log entries
-	store   *Store   // Store to store parsed lines
-	alerter *Alerter // Alerter to check for anomalies
+	lock sync.RWMutex // AddLine and AddDetector are the only writers
+
+	config    *Config    // Monitoring configuration
+	parser    Parser     // Parser to parse log entries
+	store     *Store     // Store to store parsed lines
+	detectors []Detector // Detectors to check for anomalies
 
-	last time.Time // Time of the last message processed
+	last   time.Time // Time of the last message processed
+	lines  int       // Number of lines processed
+	errors int       // Number of lines that could not be processed
 }
 
 // NewMonitor creates a new monitor from the provided configuration
-func NewMonitor(config *Config) (mon *Monitor) {
+// It returns an error if an alerting rule is invalid
+func NewMonitor(config *Config) (mon *Monitor, err error) {
 	mon = &Monitor{
 		config: config,
-		parser: &W3CParser{},
+		parser: config.Parser,
 		store:  &Store{},
 	}
 
-	if config.StoreWindow < config.AlertWindow {
-		config.StoreWindow = config.AlertWindow
+	if mon.parser == nil {
+		mon.parser = &W3CParser{}
+	}
+
+	for _, rule := range append(config.legacyRules(), config.Rules...) {
+		err = mon.addRule(rule)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	for _, detector := range config.Detectors {
+		mon.AddDetector(detector)
+	}
+
+	return mon, nil
+}
+
+// legacyRules converts the single alerter parameters to rules
+func (config *Config) legacyRules() (rules []*Rule) {
 	if config.AlertWindow > 0 && config.AlertThreshold > 0 {
-		mon.alerter = NewAlerter(config.AlertWindow, config.AlertThreshold)
+		rules = append(rules, &Rule{
+			Name:           "high_traffic",
+			Metric:         MetricRequestRate,
+			Window:         config.AlertWindow,
+			Threshold:      config.AlertThreshold,
+			ClearWindow:    config.AlertClearWindow,
+			ClearThreshold: config.AlertClearThreshold,
+		})
+	}
+
+	if config.LatencyAlertWindow > 0 && config.LatencyAlertThreshold > 0 {
+		rules = append(rules, &Rule{
+			Name:           "high_latency",
+			Metric:         MetricLatency,
+			Window:         config.LatencyAlertWindow,
+			Threshold:      config.LatencyAlertThreshold.Seconds(),
+			ClearWindow:    config.LatencyAlertClearWindow,
+			ClearThreshold: config.LatencyAlertClearThreshold.Seconds(),
+			Percentile:     latencyAlertPercentile,
+		})
+	}
+
+	if config.ErrorAlertWindow > 0 && config.ErrorAlertThreshold > 0 {
+		if config.ErrorAlertClass == 0 {
+			config.ErrorAlertClass = 5
+		}
+		rules = append(rules, &Rule{
+			Name:           "high_error_rate",
+			Metric:         MetricErrorRate,
+			Window:         config.ErrorAlertWindow,
+			Threshold:      config.ErrorAlertThreshold,
+			ClearWindow:    config.ErrorAlertClearWindow,
+			ClearThreshold: config.ErrorAlertClearThreshold,
+			Class:          config.ErrorAlertClass,
+			MinRequests:    config.ErrorAlertMinRequests,
+		})
+	}
+
+	if config.SectionAlertWindow > 0 && config.SectionAlertThreshold > 0 {
+		rules = append(rules, &Rule{
+			Name:       "high_section_traffic",
+			Metric:     MetricRequestRate,
+			Window:     config.SectionAlertWindow,
+			Threshold:  config.SectionAlertThreshold,
+			PerSection: true,
+		})
 	}
 
-	return mon
+	if config.BaselineAlertWindow > 0 && config.BaselineAlertThreshold > 0 {
+		rules = append(rules, &Rule{
+			Name:      "traffic_anomaly",
+			Metric:    MetricRequestRate,
+			Window:    config.BaselineAlertWindow,
+			Threshold: config.BaselineAlertThreshold,
+			Baseline:  &BaselineConfig{Seasonal: config.BaselineAlertSeasonal},
+		})
+	}
+
+	return rules
+}
+
+// addRule registers the Detector of the rule
+func (mon *Monitor) addRule(rule *Rule) (err error) {
+	detector, err := NewRuleDetector(rule)
+	if err != nil {
+		return err
+	}
+	mon.AddDetector(detector)
+	return nil
+}
+
+// AddDetector registers a Detector and ensures the store keeps enough requests for its window
+func (mon *Monitor) AddDetector(detector Detector) {
+	mon.lock.Lock()
+	defer mon.lock.Unlock()
+
+	if mon.config.StoreWindow < detector.Window() {
+		mon.config.StoreWindow = detector.Window()
+	}
+	mon.detectors = append(mon.detectors, detector)
 }
 
 // AddLine parse the line and update the monitor accordingly
-// It returns an alert if the line does trigger the start or end of an alert
-func (mon *Monitor) AddLine(line string) (alert *Alert, err error) {
+// It returns the alerts if the line does trigger the start or end of alerts
+// Lines of concurrent inputs must be roughly in time order as requests older than the last one are rejected
+func (mon *Monitor) AddLine(line string) (alerts []*Alert, err error) {
+	mon.lock.Lock()
+	defer mon.lock.Unlock()
+
+	mon.lines++
 
 	// Parse
 
 	req, err := mon.parser.Parse(line)
 	if err != nil {
+		mon.errors++
+		mon.observe(nil, err)
 		return nil, err
 	}
+	if req == nil {
+		mon.observe(nil, nil)
+		return nil, nil
+	}
 
 	// Store
 
 	err = mon.store.AddRequest(req)
 	if err != nil {
+		mon.errors++
+		mon.observe(nil, err)
 		return nil, err
 	}
+	mon.observe(req, nil)
 
 	// Check for alert
+	// The windows are not copied as the store is only cleaned below under the same lock
 
-	if mon.alerter != nil {
-		count := len(mon.store.Since(Deadline(req.Time, mon.config.AlertWindow)))
-		value := float64(count) / float64(mon.config.AlertWindow.Seconds())
-		alert = mon.alerter.Check(req.Time, value)
+	for _, detector := range mon.detectors {
+		alerts = append(alerts, detector.Detect(req, mon.store.since(Deadline(req.Time, detector.Window())))...)
+	}
+
+	// Notify
+
+	for _, alert := range alerts {
+		for _, notifier := range mon.config.Notifiers {
+			notifier.Notify(alert)
+		}
 	}
 
 	// Clean
@@ -72,24 +231,89 @@ func (mon *Monitor) AddLine(line string) (alert *Alert, err error) {
 	mon.store.Clean(Deadline(req.Time, mon.config.StoreWindow))
 	mon.last = req.Time
 
-	return alert, nil
+	return alerts, nil
+}
+
+func (mon *Monitor) observe(req *Request, err error) {
+	for _, observer := range mon.config.Observers {
+		observer.Observe(req, err)
+	}
 }
 
 // Stats returns summary statistics for the provided time window
 func (mon *Monitor) Stats(window time.Duration, top int) (stats *Stats) {
-	requests := mon.store.Since(Deadline(mon.last, window))
+	return mon.FilteredStats(window, top, nil)
+}
+
+// StatsSince returns summary statistics for the requests newer than since
+// along with the time of the last request, so that the calls can cover contiguous time ranges
+func (mon *Monitor) StatsSince(since time.Time, top int) (stats *Stats, last time.Time) {
+	mon.lock.RLock()
+	defer mon.lock.RUnlock()
+
+	return NewStats(mon.store.Since(since), top), mon.last
+}
+
+// FilteredStats returns summary statistics of the requests matching the filter for the provided time window
+func (mon *Monitor) FilteredStats(window time.Duration, top int, filter *Filter) (stats *Stats) {
+	mon.lock.RLock()
+	defer mon.lock.RUnlock()
+
+	requests := filterRequests(mon.store.Since(Deadline(mon.last, window)), filter)
 	return NewStats(requests, top)
 }
 
-// Alerts returns any alerts raised by the alerter
+// Alerts returns a copy of the alerts raised by the detectors ordered by start time
 func (mon *Monitor) Alerts() (alerts []*Alert) {
-	if mon.alerter == nil {
-		return nil
+	mon.lock.RLock()
+	defer mon.lock.RUnlock()
+
+	for _, detector := range mon.detectors {
+		for _, alert := range detector.Alerts() {
+			copied := *alert
+			alerts = append(alerts, &copied)
+		}
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].Start.Before(alerts[j].Start) })
+	return alerts
+}
+
+// Close flushes and closes the Notifiers
+func (mon *Monitor) Close() {
+	for _, notifier := range mon.config.Notifiers {
+		notifier.Close()
 	}
-	return mon.alerter.Alerts()
+}
+
+// StoreWindow returns the time window of requests kept in memory
+// Stats can't be computed over a larger window
+func (mon *Monitor) StoreWindow() time.Duration {
+	mon.lock.RLock()
+	defer mon.lock.RUnlock()
+
+	return mon.config.StoreWindow
 }
 
 // Last returns the time of the last message processed
 func (mon *Monitor) Last() time.Time {
+	mon.lock.RLock()
+	defer mon.lock.RUnlock()
+
 	return mon.last
 }
+
+// Lines returns the number of lines processed
+func (mon *Monitor) Lines() int {
+	mon.lock.RLock()
+	defer mon.lock.RUnlock()
+
+	return mon.lines
+}
+
+// Errors returns the number of lines that could not be processed
+func (mon *Monitor) Errors() int {
+	mon.lock.RLock()
+	defer mon.lock.RUnlock()
+
+	return mon.errors
+}
@@ -1,30 +1,473 @@
 package accessmon
 
 import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
 	"testing"
 	"time"
 )
 
 func TestMonitor_AddLineNoAlerter(t *testing.T) {
-	mon := NewMonitor(&Config{})
+	mon, err := NewMonitor(&Config{})
+	require.NoError(t, err)
 	require.NotNil(t, mon)
 
-	alert, err := mon.AddLine("127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12")
+	alerts, err := mon.AddLine("127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12")
 	require.NoError(t, err)
-	require.Nil(t, alert)
+	require.Nil(t, alerts)
 }
 
 func TestMonitor_AddLine(t *testing.T) {
-	mon := NewMonitor(&Config{AlertWindow: time.Second, AlertThreshold: 10})
+	mon, err := NewMonitor(&Config{AlertWindow: time.Second, AlertThreshold: 10})
+	require.NoError(t, err)
 	require.NotNil(t, mon)
 	require.Equal(t, mon.config.AlertWindow, mon.config.StoreWindow)
 
-	alert, err := mon.AddLine("127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12")
+	alerts, err := mon.AddLine("127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12")
 	require.NoError(t, err)
-	require.Nil(t, alert)
+	require.Nil(t, alerts)
 
 	date, _ := time.Parse(w3cDateLayout, "09/May/2018:16:00:42 +0000")
 	require.Equal(t, date, mon.Last())
 	require.Len(t, mon.Alerts(), 0)
 }
+
+func TestMonitor_AddLineParser(t *testing.T) {
+	mon, err := NewMonitor(&Config{Parser: &CombinedParser{}})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+
+	_, err = mon.AddLine("127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12")
+	require.Error(t, err)
+
+	_, err = mon.AddLine("127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12 \"-\" \"curl/7.64.0\"")
+	require.NoError(t, err)
+}
+
+func TestMonitor_AddLineErrors(t *testing.T) {
+	mon, err := NewMonitor(&Config{StoreWindow: time.Minute})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+
+	_, err = mon.AddLine("127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12")
+	require.NoError(t, err)
+
+	_, err = mon.AddLine("invalid")
+	require.Error(t, err)
+
+	_, err = mon.AddLine("127.0.0.1 - mary [09/May/2018:16:00:41 +0000] \"POST /api/user HTTP/1.0\" 503 12")
+	require.Error(t, err)
+
+	require.Equal(t, 3, mon.Lines())
+	require.Equal(t, 2, mon.Errors())
+}
+
+func TestMonitor_AddLineDirective(t *testing.T) {
+	mon, err := NewMonitor(&Config{Parser: &W3CExtendedParser{}})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+
+	alerts, err := mon.AddLine("#Fields: date time c-ip cs-method cs-uri-stem sc-status sc-bytes")
+	require.NoError(t, err)
+	require.Nil(t, alerts)
+	require.True(t, mon.Last().IsZero())
+
+	_, err = mon.AddLine("2018-05-09 16:00:42 127.0.0.1 GET /www/index.html 200 12")
+	require.NoError(t, err)
+	require.False(t, mon.Last().IsZero())
+	require.Equal(t, 0, mon.Errors())
+}
+
+func TestMonitor_AddLineLatencyAlert(t *testing.T) {
+	parser, err := NewApacheFormatParser("%t %D")
+	require.NoError(t, err)
+
+	mon, err := NewMonitor(&Config{Parser: parser, LatencyAlertWindow: 3 * time.Second, LatencyAlertThreshold: 100 * time.Millisecond})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+	require.Equal(t, 3*time.Second, mon.config.StoreWindow)
+
+	durations := []int{10, 500, 500, 500, 500, 500, 500, 10, 10, 10, 10, 10}
+	var alerts []*Alert
+	for i, d := range durations {
+		line := fmt.Sprintf("[%s] %d", start.Add(time.Duration(i)*time.Second).Format(w3cDateLayout), d*1000)
+		a, err := mon.AddLine(line)
+		require.NoError(t, err)
+		alerts = append(alerts, a...)
+	}
+
+	// the p95 stays above the threshold while a slow request remains in the window
+	// so the alert starts at 3s and ends a full window after the last slow request left it
+
+	require.Len(t, alerts, 2)
+	require.Len(t, mon.Alerts(), 1)
+	require.Equal(t, MetricLatency, mon.Alerts()[0].Metric)
+	require.Equal(t, float64(95), mon.Alerts()[0].Percentile)
+	require.True(t, start.Add(3*time.Second).Equal(mon.Alerts()[0].Start))
+	require.True(t, start.Add(11*time.Second).Equal(mon.Alerts()[0].End))
+	require.Equal(t, 0.5, mon.Alerts()[0].Value)
+}
+
+func TestMonitor_AddLineErrorRateAlert(t *testing.T) {
+	mon, err := NewMonitor(&Config{ErrorAlertWindow: 2 * time.Second, ErrorAlertThreshold: 50, ErrorAlertMinRequests: 3})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+	require.Equal(t, 5, mon.config.ErrorAlertClass)
+
+	// a single server error is not enough to trigger the alert
+
+	codes := []int{500, 200, 200, 200, 200, 200, 500, 500, 500, 500, 500, 500, 200, 200, 200, 200, 200, 200}
+	for i, code := range codes {
+		req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: "/", HTTPVersion: "HTTP/1.1", Code: code}
+		_, err := mon.AddLine(req.String())
+		require.NoError(t, err)
+		_, err = mon.AddLine(req.String())
+		require.NoError(t, err)
+	}
+
+	require.Len(t, mon.Alerts(), 1)
+	require.Equal(t, MetricErrorRate, mon.Alerts()[0].Metric)
+	require.False(t, mon.Alerts()[0].IsOngoing())
+}
+
+func TestMonitor_AddLineRules(t *testing.T) {
+	rules := []*Rule{
+		{Name: "api", Metric: MetricRequestRate, Filter: &Filter{Section: "/api"}, Window: 2 * time.Second, Threshold: 2, Severity: "warning"},
+		{Name: "www", Metric: MetricRequestRate, Filter: &Filter{Section: "/www"}, Window: 2 * time.Second, Threshold: 2, Severity: "critical"},
+	}
+	mon, err := NewMonitor(&Config{AlertWindow: 2 * time.Second, AlertThreshold: 5, Rules: rules})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+	require.Len(t, mon.detectors, 3)
+
+	// 3 req/s on /api and 1 req/s on /www
+
+	for i := 0; i < 10; i++ {
+		for _, path := range []string{"/api", "/api", "/api", "/www"} {
+			req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: path, HTTPVersion: "HTTP/1.1", Code: 200}
+			_, err := mon.AddLine(req.String())
+			require.NoError(t, err)
+		}
+	}
+
+	alerts := mon.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, "api", alerts[0].Rule)
+	require.Equal(t, "warning", alerts[0].Severity)
+	require.Equal(t, MetricRequestRate, alerts[0].Metric)
+	require.True(t, alerts[0].IsOngoing())
+}
+
+func TestConfig_LegacyRulesClear(t *testing.T) {
+	config := &Config{
+		LatencyAlertWindow:         time.Minute,
+		LatencyAlertThreshold:      time.Second,
+		LatencyAlertClearWindow:    2 * time.Minute,
+		LatencyAlertClearThreshold: 500 * time.Millisecond,
+		ErrorAlertWindow:           time.Minute,
+		ErrorAlertThreshold:        10,
+		ErrorAlertClearWindow:      3 * time.Minute,
+		ErrorAlertClearThreshold:   5,
+	}
+
+	rules := config.legacyRules()
+	require.Len(t, rules, 2)
+	require.Equal(t, 2*time.Minute, rules[0].ClearWindow)
+	require.Equal(t, 0.5, rules[0].ClearThreshold)
+	require.Equal(t, 3*time.Minute, rules[1].ClearWindow)
+	require.Equal(t, float64(5), rules[1].ClearThreshold)
+}
+
+func TestNewMonitorInvalidRule(t *testing.T) {
+	rules := []*Rule{{Name: "invalid", Metric: "invalid", Window: 2 * time.Second, Threshold: 2}}
+	mon, err := NewMonitor(&Config{Rules: rules})
+	require.Error(t, err)
+	require.Nil(t, mon)
+
+	mon, err = NewMonitor(&Config{AlertWindow: 2 * time.Second, AlertThreshold: 5, AlertClearThreshold: 10})
+	require.Error(t, err)
+	require.Nil(t, mon)
+
+	// Zero parameters stand for the defaults and are left untouched
+
+	rules = []*Rule{{Name: "slow", Metric: MetricLatency, Window: 2 * time.Second, Threshold: 1}}
+	mon, err = NewMonitor(&Config{Rules: rules})
+	require.NoError(t, err)
+	require.Len(t, mon.detectors, 1)
+	require.Equal(t, float64(0), rules[0].Percentile)
+}
+
+func TestRuleDetector_LatencyRefresh(t *testing.T) {
+	detector, err := NewRuleDetector(&Rule{Name: "latency", Metric: MetricLatency, Window: 10 * time.Second, Threshold: 1})
+	require.NoError(t, err)
+	d := detector.(*ruleDetector)
+
+	fast := &Request{Time: start, Duration: 10 * time.Millisecond, HasDuration: true}
+	slow := &Request{Time: start, Duration: 2 * time.Second, HasDuration: true}
+
+	// The percentile is reused until a hundredth of the window has elapsed
+
+	d.Detect(fast, []*Request{fast})
+	require.Equal(t, 0.01, d.latency[""].value)
+
+	slow.Time = start.Add(50 * time.Millisecond)
+	d.Detect(slow, []*Request{fast, slow, slow})
+	require.Equal(t, 0.01, d.latency[""].value)
+
+	slow.Time = start.Add(100 * time.Millisecond)
+	d.Detect(slow, []*Request{fast, slow, slow})
+	require.Equal(t, float64(2), d.latency[""].value)
+}
+
+func TestMonitor_StatsSince(t *testing.T) {
+	mon, err := NewMonitor(&Config{StoreWindow: time.Minute})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: "/api", HTTPVersion: "HTTP/1.1", Code: 200}
+		_, err := mon.AddLine(req.String())
+		require.NoError(t, err)
+	}
+
+	stats, last := mon.StatsSince(start.Add(6*time.Second), 1)
+	require.Equal(t, 3, stats.Count)
+	require.True(t, start.Add(9*time.Second).Equal(last))
+
+	stats, _ = mon.StatsSince(last, 1)
+	require.Equal(t, 0, stats.Count)
+}
+
+func TestMonitor_AddLineSectionAlert(t *testing.T) {
+	mon, err := NewMonitor(&Config{SectionAlertWindow: 2 * time.Second, SectionAlertThreshold: 2})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+	require.Len(t, mon.detectors, 1)
+
+	// 3 req/s on /api and 1 req/s on /www for 5 seconds then 1 req/s on /www only
+
+	var started, ended []*Alert
+	for i := 0; i < 10; i++ {
+		paths := []string{"/api", "/api", "/api", "/www"}
+		if i >= 5 {
+			paths = []string{"/www"}
+		}
+		for _, path := range paths {
+			req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: path, HTTPVersion: "HTTP/1.1", Code: 200}
+			alerts, err := mon.AddLine(req.String())
+			require.NoError(t, err)
+			for _, alert := range alerts {
+				if alert.IsOngoing() {
+					started = append(started, alert)
+				} else {
+					ended = append(ended, alert)
+				}
+			}
+		}
+	}
+
+	require.Len(t, started, 1)
+	require.Equal(t, "/api", started[0].Section)
+	require.Equal(t, "high_section_traffic", started[0].Rule)
+
+	require.Len(t, ended, 1)
+	require.Equal(t, "/api", ended[0].Section)
+
+	// The idle section Alerter is removed but its alerts are kept
+
+	require.Len(t, mon.detectors[0].(*ruleDetector).sections, 1)
+	require.Len(t, mon.Alerts(), 1)
+}
+
+func TestMonitor_AddLineSectionBaselineEviction(t *testing.T) {
+	rule := &Rule{Name: "section_anomaly", Metric: MetricRequestRate, Window: time.Second, Threshold: 3, PerSection: true, Baseline: &BaselineConfig{}}
+	mon, err := NewMonitor(&Config{Rules: []*Rule{rule}})
+	require.NoError(t, err)
+	require.Len(t, mon.detectors, 1)
+
+	// /api and /www for 5 seconds then /www only for more than baselineIdleWindows windows
+
+	for i := 0; i < 5+baselineIdleWindows+2; i++ {
+		paths := []string{"/api", "/www"}
+		if i >= 5 {
+			paths = []string{"/www"}
+		}
+		for _, path := range paths {
+			req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: path, HTTPVersion: "HTTP/1.1", Code: 200}
+			_, err := mon.AddLine(req.String())
+			require.NoError(t, err)
+		}
+	}
+
+	detector := mon.detectors[0].(*ruleDetector)
+	require.Len(t, detector.sections, 1)
+	require.Len(t, detector.baselines, 1)
+	require.NotNil(t, detector.baselines["/www"])
+}
+
+func TestMonitor_AddLineBaselineAlert(t *testing.T) {
+	mon, err := NewMonitor(&Config{BaselineAlertWindow: 5 * time.Second, BaselineAlertThreshold: 3})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+	require.Len(t, mon.detectors, 1)
+
+	// 1 or 2 req/s for 5 minutes then a 10 req/s flood
+
+	for i := 0; i < 330; i++ {
+		count := 1 + i%2
+		if i >= 300 {
+			count = 10
+		}
+		for j := 0; j < count; j++ {
+			req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: "/api", HTTPVersion: "HTTP/1.1", Code: 200}
+			_, err := mon.AddLine(req.String())
+			require.NoError(t, err)
+		}
+	}
+
+	alerts := mon.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, "traffic_anomaly", alerts[0].Rule)
+	require.True(t, alerts[0].Baseline)
+	require.True(t, alerts[0].Value >= 3)
+	require.True(t, alerts[0].IsOngoing())
+}
+
+// userDetector raises an alert on the first request of a given user
+type userDetector struct {
+	user   string
+	alerts []*Alert
+}
+
+func (d *userDetector) Window() time.Duration {
+	return 5 * time.Second
+}
+
+func (d *userDetector) Detect(req *Request, window []*Request) (alerts []*Alert) {
+	if req.User != d.user || len(d.alerts) > 0 {
+		return nil
+	}
+	alert := &Alert{Rule: "user_" + d.user, Start: req.Time, Value: float64(len(window))}
+	d.alerts = append(d.alerts, alert)
+	return []*Alert{alert}
+}
+
+func (d *userDetector) Alerts() (alerts []*Alert) {
+	return d.alerts
+}
+
+func TestMonitor_AddLineDetector(t *testing.T) {
+	mon, err := NewMonitor(&Config{StoreWindow: time.Second, Detectors: []Detector{&userDetector{user: "john"}}})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+	require.Equal(t, 5*time.Second, mon.config.StoreWindow)
+
+	for i, user := range []string{"mary", "mary", "john", "john"} {
+		req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: user, Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: "/api", HTTPVersion: "HTTP/1.1", Code: 200}
+		alerts, err := mon.AddLine(req.String())
+		require.NoError(t, err)
+		if i == 2 {
+			require.Len(t, alerts, 1)
+			require.Equal(t, "user_john", alerts[0].Rule)
+			require.Equal(t, float64(3), alerts[0].Value)
+		} else {
+			require.Len(t, alerts, 0)
+		}
+	}
+
+	require.Len(t, mon.Alerts(), 1)
+}
+
+// recordNotifier records the notified alerts
+type recordNotifier struct {
+	alerts []*Alert
+	closed bool
+}
+
+func (n *recordNotifier) Notify(alert *Alert) {
+	n.alerts = append(n.alerts, alert)
+}
+
+func (n *recordNotifier) Close() {
+	n.closed = true
+}
+
+func TestMonitor_AddLineNotify(t *testing.T) {
+	notifier := &recordNotifier{}
+	mon, err := NewMonitor(&Config{AlertWindow: 2 * time.Second, AlertThreshold: 2, Notifiers: []Notifier{notifier}})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+
+	for i := 0; i < 10; i++ {
+		count := 3
+		if i >= 5 {
+			count = 1
+		}
+		for j := 0; j < count; j++ {
+			req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: "/api", HTTPVersion: "HTTP/1.1", Code: 200}
+			_, err := mon.AddLine(req.String())
+			require.NoError(t, err)
+		}
+	}
+
+	mon.Close()
+	require.True(t, notifier.closed)
+
+	// The alert is notified when it starts and when it ends, each notification is a snapshot
+
+	require.Len(t, notifier.alerts, 2)
+	require.Equal(t, notifier.alerts[0].Start, notifier.alerts[1].Start)
+	require.True(t, notifier.alerts[0].IsOngoing())
+	require.False(t, notifier.alerts[1].IsOngoing())
+}
+
+func TestMonitor_AddLineConcurrent(t *testing.T) {
+	mon, err := NewMonitor(&Config{StoreWindow: time.Minute, AlertWindow: time.Second, AlertThreshold: 1})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+
+	// Several inputs with the same request times and concurrent queries
+
+	var wg sync.WaitGroup
+	for input := 0; input < 4; input++ {
+		wg.Add(1)
+		go func(input int) {
+			defer wg.Done()
+			req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start, Method: "GET", Path: fmt.Sprintf("/input%d", input), HTTPVersion: "HTTP/1.1", Code: 200}
+			for i := 0; i < 500; i++ {
+				_, err := mon.AddLine(req.String())
+				assert.NoError(t, err)
+			}
+		}(input)
+	}
+	for i := 0; i < 100; i++ {
+		_ = mon.Stats(time.Minute, 10)
+		_ = mon.Alerts()
+		_ = mon.Last()
+	}
+	wg.Wait()
+
+	require.Equal(t, 2000, mon.Lines())
+	require.Equal(t, 0, mon.Errors())
+	require.Equal(t, 2000, mon.Stats(time.Minute, 10).Count)
+	require.Len(t, mon.Stats(time.Minute, 10).TopSection, 4)
+}
+
+func TestMonitor_FilteredStats(t *testing.T) {
+	mon, err := NewMonitor(&Config{StoreWindow: time.Minute})
+	require.NoError(t, err)
+	require.NotNil(t, mon)
+
+	for i, path := range []string{"/api/user", "/api/user", "/www"} {
+		req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: path, HTTPVersion: "HTTP/1.1", Code: 200}
+		_, err := mon.AddLine(req.String())
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, 3, mon.FilteredStats(time.Minute, 10, nil).Count)
+	require.Equal(t, 2, mon.FilteredStats(time.Minute, 10, &Filter{Section: "/api"}).Count)
+	require.Equal(t, 1, mon.FilteredStats(time.Second, 10, &Filter{Section: "/www"}).Count)
+	require.Equal(t, 0, mon.FilteredStats(time.Minute, 10, &Filter{User: "john"}).Count)
+}
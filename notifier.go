@@ -0,0 +1,193 @@
+package accessmon
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Notifier sends the alerts to an external system
+// Notify is called from the line processing loop and must not block
+type Notifier interface {
+	// Notify is called each time an alert starts or ends
+	Notify(alert *Alert)
+
+	// Close flushes the pending notifications and releases the resources
+	Close()
+}
+
+// Alert event statuses
+const (
+	AlertStatusOpen   = "open"
+	AlertStatusClosed = "closed"
+)
+
+// AlertEvent is a snapshot of an alert at the time it did start or end
+// Alerts are updated by the Monitor so Notifiers must use a snapshot to work asynchronously
+type AlertEvent struct {
+	Rule     string     `json:"rule"`
+	Severity string     `json:"severity,omitempty"`
+	Metric   string     `json:"metric"`
+	Section  string     `json:"section,omitempty"`
+	Status   string     `json:"status"` // AlertStatusOpen or AlertStatusClosed
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"`
+	Value    float64    `json:"value"`
+	Baseline bool       `json:"baseline,omitempty"`
+	Duration float64    `json:"duration"` // in seconds, 0 while the alert is ongoing
+	Host     string     `json:"host"`
+}
+
+// NewAlertEvent builds a snapshot of the alert
+func NewAlertEvent(alert *Alert, host string) (event *AlertEvent) {
+	event = &AlertEvent{
+		Rule:     alert.Rule,
+		Severity: alert.Severity,
+		Metric:   alert.Metric,
+		Section:  alert.Section,
+		Status:   AlertStatusOpen,
+		Start:    alert.Start,
+		Value:    alert.Value,
+		Baseline: alert.Baseline,
+		Host:     host,
+	}
+	if !alert.IsOngoing() {
+		end := alert.End
+		event.End = &end
+		event.Status = AlertStatusClosed
+		event.Duration = alert.End.Sub(alert.Start).Seconds()
+	}
+	return event
+}
+
+// asyncNotifierCloseTimeout is the time Close waits for the pending events to be sent
+const asyncNotifierCloseTimeout = 10 * time.Second
+
+// asyncNotifier queues the alert events and sends them from a background goroutine
+// The queue is bounded so that a slow destination never blocks the line processing
+// Events received within the batch interval of the first one are sent together
+type asyncNotifier struct {
+	dropped int64 // number of events dropped because the queue was full ( first for 64-bit atomic alignment )
+
+	send  func(events []*AlertEvent) // called from the background goroutine
+	batch time.Duration
+	host  string
+
+	queue  chan *AlertEvent
+	done   chan struct{}
+	lock   sync.RWMutex // protects the queue from being closed while sending
+	closed bool
+
+	// ctx is cancelled when Close gives up on the pending events
+	// send must return early once it is done
+	ctx          context.Context
+	cancel       context.CancelFunc
+	closeTimeout time.Duration
+}
+
+// newAsyncNotifier builds an asyncNotifier and starts its background goroutine
+// With a zero batch interval the events are sent one by one
+func newAsyncNotifier(size int, batch time.Duration, send func(events []*AlertEvent)) (notifier *asyncNotifier) {
+	notifier = &asyncNotifier{
+		send:  send,
+		batch: batch,
+		host:  hostname(),
+		queue: make(chan *AlertEvent, size),
+		done:  make(chan struct{}),
+
+		closeTimeout: asyncNotifierCloseTimeout,
+	}
+	notifier.ctx, notifier.cancel = context.WithCancel(context.Background())
+
+	go notifier.run()
+
+	return notifier
+}
+
+// Notify queues the alert event, it is dropped if the queue is full or the notifier closed
+func (notifier *asyncNotifier) Notify(alert *Alert) {
+	notifier.lock.RLock()
+	defer notifier.lock.RUnlock()
+
+	if notifier.closed {
+		atomic.AddInt64(&notifier.dropped, 1)
+		return
+	}
+
+	select {
+	case notifier.queue <- NewAlertEvent(alert, notifier.host):
+	default:
+		atomic.AddInt64(&notifier.dropped, 1)
+	}
+}
+
+// Close sends the pending events and stops the background goroutine
+// The events still pending after the close timeout are dropped
+func (notifier *asyncNotifier) Close() {
+	notifier.lock.Lock()
+	if !notifier.closed {
+		notifier.closed = true
+		close(notifier.queue)
+	}
+	notifier.lock.Unlock()
+
+	timer := time.NewTimer(notifier.closeTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-notifier.done:
+	case <-timer.C:
+		// Interrupt the event being sent, the pending ones are dropped
+		notifier.cancel()
+		<-notifier.done
+	}
+	notifier.cancel()
+}
+
+// Dropped returns the number of events dropped because the queue was full or the notifier closed
+// or because they could not be sent before the close timeout
+func (notifier *asyncNotifier) Dropped() int {
+	return int(atomic.LoadInt64(&notifier.dropped))
+}
+
+func (notifier *asyncNotifier) run() {
+	defer close(notifier.done)
+
+	for event := range notifier.queue {
+		events := []*AlertEvent{event}
+
+		if notifier.batch > 0 {
+			timer := time.NewTimer(notifier.batch)
+		BATCH:
+			for {
+				select {
+				case event, ok := <-notifier.queue:
+					if !ok {
+						break BATCH
+					}
+					events = append(events, event)
+				case <-timer.C:
+					break BATCH
+				}
+			}
+			timer.Stop()
+		}
+
+		if notifier.ctx.Err() != nil {
+			atomic.AddInt64(&notifier.dropped, int64(len(events)))
+			continue
+		}
+		notifier.send(events)
+	}
+}
+
+// hostname returns the name of the host reported in the alert events
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return host
+}
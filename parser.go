@@ -9,6 +9,7 @@ import (
 )
 
 // Parser is an interface that parses a line of log to a Request object
+// Lines holding no request ( like directives ) are parsed to a nil Request and no error
 type Parser interface {
 	Parse(line string) (*Request, error)
 }
@@ -44,67 +45,81 @@ func (parser *W3CParser) Parse(line string) (req *Request, err error) {
 
 	line = strings.TrimRight(line, "\r\n")
 
+	// Parse the common part
+
+	req, sizeStr, err := parseCommon(line)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the remaining size
+
+	req.Size, err = strconv.Atoi(sizeStr)
+	if err != nil {
+		return nil, newParsingError("invalid size")
+	}
+
+	return req, nil
+}
+
+// parseCommon parses the Common Log Format fields up to the status code
+// It returns the Request without Size and the rest of the line after the status code
+func parseCommon(line string) (req *Request, rest string, err error) {
+
 	// Split
 
 	line, ipStr, err := parseNext(line, " - ")
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	line, username, err := parseNext(line, " [")
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	line, dateStr, err := parseNext(line, "] \"")
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	line, method, err := parseNext(line, " ")
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	line, path, err := parseNext(line, " ")
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	line, httpVersion, err := parseNext(line, "\" ")
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	line, codeStr, err := parseNext(line, " ")
+	rest, codeStr, err := parseNext(line, " ")
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	sizeStr := line
-
 	// Parse
 
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
-		return nil, newParsingError("invalid ip")
+		return nil, "", newParsingError("invalid ip")
 	}
 
 	date, err := time.Parse(w3cDateLayout, dateStr)
 	if err != nil {
-		return nil, newParsingError("invalid date")
+		return nil, "", newParsingError("invalid date")
 	}
 
 	section := parseSection(path)
 
 	code, err := strconv.Atoi(codeStr)
 	if err != nil {
-		return nil, newParsingError("invalid code")
-	}
-
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		return nil, newParsingError("invalid size")
+		return nil, "", newParsingError("invalid code")
 	}
 
 	// Build
@@ -118,10 +133,9 @@ func (parser *W3CParser) Parse(line string) (req *Request, err error) {
 		Section:     section,
 		HTTPVersion: httpVersion,
 		Code:        code,
-		Size:        size,
 	}
 
-	return req, nil
+	return req, rest, nil
 }
 
 func parseSection(path string) (section string) {
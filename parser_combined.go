@@ -0,0 +1,66 @@
+package accessmon
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CombinedParser is a Parser implementation for the Combined Log Format
+// used by default by both Apache and nginx
+// see : https://httpd.apache.org/docs/current/logs.html#combined
+// 127.0.0.1 - mary [09/May/2018:16:00:42 +0000] "POST /api/user HTTP/1.0" 503 12 "http://www.example.com/" "Mozilla/5.0"
+type CombinedParser struct{}
+
+// Parse a Combined Log Format line into a Request object
+func (parser *CombinedParser) Parse(line string) (req *Request, err error) {
+
+	// Trim new lines
+
+	line = strings.TrimRight(line, "\r\n")
+
+	// Parse the common part
+
+	req, line, err = parseCommon(line)
+	if err != nil {
+		return nil, err
+	}
+
+	// Split
+
+	line, sizeStr, err := parseNext(line, " \"")
+	if err != nil {
+		return nil, err
+	}
+
+	// The referrer might be empty so parseNext can't be used here
+
+	i := strings.Index(line, "\" \"")
+	if i < 0 {
+		return nil, newParsingError("invalid line separator \"\\\" \\\"\" not found")
+	}
+	referrer, line := line[:i], line[i+3:]
+
+	if !strings.HasSuffix(line, "\"") {
+		return nil, newParsingError("invalid user agent")
+	}
+	userAgent := strings.TrimSuffix(line, "\"")
+
+	// Parse
+
+	// Apache logs "-" instead of 0 when no bytes were sent
+	size := 0
+	if sizeStr != "-" {
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil {
+			return nil, newParsingError("invalid size")
+		}
+	}
+
+	// Build
+
+	req.Size = size
+	req.Referrer = referrer
+	req.UserAgent = userAgent
+
+	return req, nil
+}
@@ -0,0 +1,55 @@
+package accessmon
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCombinedParser_Parse(t *testing.T) {
+	parser := &CombinedParser{}
+
+	_, err := parser.Parse("")
+	require.Errorf(t, err, "missing error")
+
+	req, err := parser.Parse("127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12 \"http://www.example.com/start.html\" \"Mozilla/5.0 (X11; Linux x86_64)\"")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", req.SourceIP.String())
+	require.Equal(t, "mary", req.User)
+	require.Equal(t, "09/May/2018:16:00:42 +0000", req.Time.Format(w3cDateLayout))
+	require.Equal(t, "POST", req.Method)
+	require.Equal(t, "/api/user", req.Path)
+	require.Equal(t, "/api", req.Section)
+	require.Equal(t, "HTTP/1.0", req.HTTPVersion)
+	require.Equal(t, 503, req.Code)
+	require.Equal(t, 12, req.Size)
+	require.Equal(t, "http://www.example.com/start.html", req.Referrer)
+	require.Equal(t, "Mozilla/5.0 (X11; Linux x86_64)", req.UserAgent)
+}
+
+func TestCombinedParser_ParseEmpty(t *testing.T) {
+	parser := &CombinedParser{}
+
+	req, err := parser.Parse("127.0.0.1 - - [09/May/2018:16:00:42 +0000] \"GET / HTTP/1.1\" 304 - \"-\" \"\"\n")
+	require.NoError(t, err)
+	require.Equal(t, 304, req.Code)
+	require.Equal(t, 0, req.Size)
+	require.Equal(t, "-", req.Referrer)
+	require.Equal(t, "", req.UserAgent)
+}
+
+func TestCombinedParser_ParseError(t *testing.T) {
+	parser := &CombinedParser{}
+
+	inputs := []string{
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 invalid \"-\" \"-\"",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12 \"-\"",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12 \"-\" \"-",
+		"invalid - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12 \"-\" \"-\"",
+	}
+
+	for _, input := range inputs {
+		_, err := parser.Parse(input)
+		require.Error(t, err, input)
+	}
+}
@@ -0,0 +1,201 @@
+package accessmon
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ELBParser is a Parser implementation for AWS Application and Classic Load Balancer access logs
+// see : https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-access-logs.html
+// see : https://docs.aws.amazon.com/elasticloadbalancing/latest/classic/access-log-collection.html
+// http 2018-07-02T22:23:00.186641Z app/my-lb/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0" - - ...
+// 2015-05-13T23:39:43.945958Z my-lb 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -
+type ELBParser struct{}
+
+// Field positions in the Classic Load Balancer format
+// Application Load Balancer logs have an additional leading type field
+const (
+	elbTime = iota
+	elbName
+	elbClient
+	elbTarget
+	elbRequestProcessingTime
+	elbTargetProcessingTime
+	elbResponseProcessingTime
+	elbStatusCode
+	elbTargetStatusCode
+	elbReceivedBytes
+	elbSentBytes
+	elbRequest
+	elbUserAgent
+	elbSSLCipher
+	elbSSLProtocol
+	elbFields
+)
+
+// splitQuoted splits the line on spaces except inside double quotes
+// The double quotes are removed from the returned fields
+func splitQuoted(line string) (fields []string, err error) {
+	for len(line) > 0 {
+		if line[0] == ' ' {
+			line = line[1:]
+			continue
+		}
+
+		var field string
+		if line[0] == '"' {
+			i := strings.Index(line[1:], "\"")
+			if i < 0 {
+				return nil, newParsingError("invalid line unterminated quote")
+			}
+			field, line = line[1:i+1], line[i+2:]
+		} else {
+			i := strings.Index(line, " ")
+			if i < 0 {
+				i = len(line)
+			}
+			field, line = line[:i], line[i:]
+		}
+
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Parse an ELB access log line into a Request object
+func (parser *ELBParser) Parse(line string) (req *Request, err error) {
+
+	// Trim new lines
+
+	line = strings.TrimRight(line, "\r\n")
+
+	// Split
+
+	fields, err := splitQuoted(line)
+	if err != nil {
+		return nil, err
+	}
+
+	// Application Load Balancer logs start with the request type ( http, https, h2, ws, wss, grpcs )
+
+	if len(fields) > 0 {
+		if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) < elbFields {
+		return nil, newParsingError("invalid line too short")
+	}
+
+	// TCP listeners log connections with no HTTP request
+
+	if fields[elbRequest] == "- - -" {
+		return nil, nil
+	}
+
+	// Parse
+
+	date, err := time.Parse(time.RFC3339Nano, fields[elbTime])
+	if err != nil {
+		return nil, newParsingError("invalid date")
+	}
+
+	host, _, err := net.SplitHostPort(fields[elbClient])
+	if err != nil {
+		return nil, newParsingError("invalid ip")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, newParsingError("invalid ip")
+	}
+
+	parts := strings.Split(fields[elbRequest], " ")
+	if len(parts) != 3 {
+		return nil, newParsingError("invalid request")
+	}
+	u, err := url.Parse(parts[1])
+	if err != nil {
+		return nil, newParsingError("invalid request")
+	}
+	path := u.RequestURI()
+	if !strings.HasPrefix(path, "/") {
+		return nil, newParsingError("invalid request")
+	}
+
+	code, err := strconv.Atoi(fields[elbStatusCode])
+	if err != nil {
+		return nil, newParsingError("invalid code")
+	}
+
+	size, err := strconv.Atoi(fields[elbSentBytes])
+	if err != nil {
+		return nil, newParsingError("invalid size")
+	}
+
+	// The following fields are "-" or -1 if the request could not be dispatched to a target
+
+	upstreamAddr := ""
+	if fields[elbTarget] != "-" {
+		upstreamAddr, _, err = net.SplitHostPort(fields[elbTarget])
+		if err != nil {
+			return nil, newParsingError("invalid target")
+		}
+	}
+
+	upstreamCode := 0
+	if fields[elbTargetStatusCode] != "-" {
+		upstreamCode, err = strconv.Atoi(fields[elbTargetStatusCode])
+		if err != nil {
+			return nil, newParsingError("invalid target status code")
+		}
+	}
+
+	var durations [3]time.Duration
+	for i, field := range []int{elbRequestProcessingTime, elbTargetProcessingTime, elbResponseProcessingTime} {
+		durations[i], err = parseELBDuration(fields[field])
+		if err != nil {
+			return nil, newParsingError("invalid processing time")
+		}
+	}
+
+	// Build
+
+	req = &Request{
+		SourceIP:         ip,
+		Time:             date,
+		Method:           parts[0],
+		Path:             path,
+		Section:          parseSection(path),
+		HTTPVersion:      parts[2],
+		Code:             code,
+		Size:             size,
+		UserAgent:        fields[elbUserAgent],
+		Duration:         durations[0] + durations[1] + durations[2],
+		HasDuration:      fields[elbRequestProcessingTime] != "-1",
+		UpstreamAddr:     upstreamAddr,
+		UpstreamCode:     upstreamCode,
+		UpstreamDuration: durations[1],
+		TLSCipher:        elbOptional(fields[elbSSLCipher]),
+	}
+
+	return req, nil
+}
+
+// parseELBDuration parses a processing time in seconds, -1 if unknown
+func parseELBDuration(value string) (time.Duration, error) {
+	if value == "-1" {
+		return 0, nil
+	}
+	return parseDecimalDuration(value, time.Second)
+}
+
+func elbOptional(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package accessmon
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSplitQuoted(t *testing.T) {
+	fields, err := splitQuoted("")
+	require.NoError(t, err)
+	require.Len(t, fields, 0)
+
+	fields, err = splitQuoted("a  \"b c\" \"\" d")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b c", "", "d"}, fields)
+
+	_, err = splitQuoted("a \"b c")
+	require.Error(t, err)
+}
+
+func TestELBParser_ParseALB(t *testing.T) {
+	parser := &ELBParser{}
+
+	_, err := parser.Parse("")
+	require.Errorf(t, err, "missing error")
+
+	req, err := parser.Parse("https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.086 0.048 0.037 502 200 0 57 \"GET https://www.example.com:443/api/user?id=1 HTTP/1.1\" \"curl/7.46.0\" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 \"Root=1-58337281-1d84f3d73c47ec4e58577259\" \"www.example.com\" \"arn:aws:acm:us-east-2:123456789012:certificate/12345678-1234-1234-1234-123456789012\" 1 2018-07-02T22:22:48.364000Z \"authenticate,forward\" \"-\" \"-\" \"10.0.0.1:80\" \"200\" \"-\" \"-\"\n")
+	require.NoError(t, err)
+	require.Equal(t, "192.168.131.39", req.SourceIP.String())
+	require.Equal(t, "", req.User)
+	require.Equal(t, time.Date(2018, time.July, 2, 22, 23, 0, 186641000, time.UTC), req.Time)
+	require.Equal(t, "GET", req.Method)
+	require.Equal(t, "/api/user?id=1", req.Path)
+	require.Equal(t, "/api", req.Section)
+	require.Equal(t, "HTTP/1.1", req.HTTPVersion)
+	require.Equal(t, 502, req.Code)
+	require.Equal(t, 57, req.Size)
+	require.Equal(t, "curl/7.46.0", req.UserAgent)
+	require.Equal(t, "10.0.0.1", req.UpstreamAddr)
+	require.Equal(t, 200, req.UpstreamCode)
+	require.True(t, req.HasDuration)
+	require.Equal(t, 171*time.Millisecond, req.Duration)
+	require.Equal(t, 48*time.Millisecond, req.UpstreamDuration)
+	require.Equal(t, "ECDHE-RSA-AES128-GCM-SHA256", req.TLSCipher)
+}
+
+func TestELBParser_ParseClassic(t *testing.T) {
+	parser := &ELBParser{}
+
+	req, err := parser.Parse("2015-05-13T23:39:43.945958Z my-loadbalancer [2001:db8::1]:2817 - -1 -1 -1 503 - 0 0 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" - -")
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8::1", req.SourceIP.String())
+	require.True(t, req.IsIPv6())
+	require.Equal(t, "/", req.Path)
+	require.Equal(t, "/", req.Section)
+	require.Equal(t, 503, req.Code)
+	require.Equal(t, "", req.UpstreamAddr)
+	require.Equal(t, 0, req.UpstreamCode)
+	require.False(t, req.HasDuration)
+	require.Equal(t, time.Duration(0), req.UpstreamDuration)
+	require.Equal(t, "", req.TLSCipher)
+}
+
+func TestELBParser_ParseTCP(t *testing.T) {
+	parser := &ELBParser{}
+
+	req, err := parser.Parse("2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.001069 0.000028 0.000041 - - 82 305 \"- - -\" \"-\" - -")
+	require.NoError(t, err)
+	require.Nil(t, req)
+}
+
+func TestELBParser_ParseError(t *testing.T) {
+	parser := &ELBParser{}
+
+	inputs := []string{
+		"2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" -",
+		"invalid my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" - -",
+		"2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" - -",
+		"2015-05-13T23:39:43.945958Z my-loadbalancer invalid:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" - -",
+		"2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 invalid 0.000057 200 200 0 29 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" - -",
+		"2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 invalid 200 0 29 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" - -",
+		"2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 invalid 0 29 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" - -",
+		"2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 invalid \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" - -",
+		"2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 \"GET /\" \"curl/7.38.0\" - -",
+		"2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1 0.000073 0.001048 0.000057 200 200 0 29 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0\" - -",
+		"2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 \"GET http://www.example.com:80/ HTTP/1.1\" \"curl/7.38.0 - -",
+	}
+
+	for _, input := range inputs {
+		_, err := parser.Parse(input)
+		require.Error(t, err, input)
+	}
+}
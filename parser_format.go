@@ -0,0 +1,445 @@
+package accessmon
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatParser is a Parser implementation built at runtime from an
+// Apache LogFormat string or an nginx log_format string
+// see : https://httpd.apache.org/docs/current/mod/mod_log_config.html#formats
+// see : http://nginx.org/en/docs/http/ngx_http_log_module.html#log_format
+// %h %l %u %t "%r" %>s %b
+// $remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent
+type FormatParser struct {
+	tokens []*formatToken
+}
+
+// formatField identifies which Request field a log format directive maps to
+type formatField int
+
+const (
+	fieldSkip formatField = iota // known or unknown directive not mapped to any Request field
+	fieldSourceIP
+	fieldUser
+	fieldTime        // 02/Jan/2006:15:04:05 -0700
+	fieldTimeISO8601 // 2006-01-02T15:04:05-07:00
+	fieldTimeMsec    // seconds since epoch with milliseconds resolution
+	fieldRequest     // METHOD PATH PROTOCOL
+	fieldMethod
+	fieldPath
+	fieldHTTPVersion
+	fieldCode
+	fieldSize
+	fieldReferrer
+	fieldUserAgent
+	fieldTLSCipher
+	fieldQuery                // query string without the leading ?
+	fieldDurationSeconds      // decimal number of seconds
+	fieldDurationMilliseconds // decimal number of milliseconds
+	fieldDurationMicroseconds // decimal number of microseconds
+	fieldUpstreamDuration     // comma separated decimal numbers of seconds
+)
+
+// formatToken is either a literal string or a directive
+type formatToken struct {
+	literal string
+	field   formatField
+	name    string // directive name for error messages
+}
+
+func (token *formatToken) isLiteral() bool {
+	return token.name == ""
+}
+
+// apacheDirectives maps Apache LogFormat directives to Request fields
+// Directives that are not listed here are parsed but ignored
+var apacheDirectives = map[string]formatField{
+	"a": fieldSourceIP,
+	"h": fieldSourceIP,
+	"u": fieldUser,
+	"t": fieldTime,
+	"r": fieldRequest,
+	"m": fieldMethod,
+	"U": fieldPath,
+	"H": fieldHTTPVersion,
+	"s": fieldCode,
+	"b": fieldSize,
+	"B": fieldSize,
+	"D": fieldDurationMicroseconds,
+	"T": fieldDurationSeconds,
+}
+
+// apacheDurationUnits maps the Apache %{UNIT}T directive units to Request duration fields
+var apacheDurationUnits = map[string]formatField{
+	"s":  fieldDurationSeconds,
+	"ms": fieldDurationMilliseconds,
+	"us": fieldDurationMicroseconds,
+}
+
+// apacheHeaders maps Apache %{Header}i directives to Request fields
+var apacheHeaders = map[string]formatField{
+	"referer":    fieldReferrer,
+	"user-agent": fieldUserAgent,
+}
+
+// nginxVariables maps nginx log_format variables to Request fields
+// Variables that are not listed here are parsed but ignored
+var nginxVariables = map[string]formatField{
+	"remote_addr":     fieldSourceIP,
+	"remote_user":     fieldUser,
+	"time_local":      fieldTime,
+	"time_iso8601":    fieldTimeISO8601,
+	"msec":            fieldTimeMsec,
+	"request":         fieldRequest,
+	"request_method":  fieldMethod,
+	"uri":             fieldPath,
+	"server_protocol": fieldHTTPVersion,
+	"status":          fieldCode,
+	"body_bytes_sent": fieldSize,
+	"http_referer":    fieldReferrer,
+	"http_user_agent": fieldUserAgent,
+	"request_time":    fieldDurationSeconds,
+
+	"upstream_response_time": fieldUpstreamDuration,
+}
+
+// NewApacheFormatParser builds a FormatParser from an Apache LogFormat string
+func NewApacheFormatParser(format string) (parser *FormatParser, err error) {
+	parser = &FormatParser{}
+
+	for len(format) > 0 {
+		i := strings.Index(format, "%")
+		if i < 0 {
+			parser.addLiteral(format)
+			break
+		}
+		parser.addLiteral(format[:i])
+		format = format[i+1:]
+
+		// Skip status code conditions and redirect modifiers : %400,501{User-agent}i %>s
+		format = strings.TrimLeft(format, "!0123456789,<>")
+		if len(format) == 0 {
+			return nil, newFormatError("unterminated directive")
+		}
+
+		if format[0] == '%' {
+			parser.addLiteral("%")
+			format = format[1:]
+			continue
+		}
+
+		param := ""
+		if format[0] == '{' {
+			j := strings.Index(format, "}")
+			if j < 0 || j == len(format)-1 {
+				return nil, newFormatError("unterminated directive")
+			}
+			param, format = format[1:j], format[j+1:]
+		}
+
+		name := format[:1]
+		format = format[1:]
+
+		field := fieldSkip
+		switch {
+		case name == "i":
+			field = apacheHeaders[strings.ToLower(param)]
+		case name == "t" && param != "":
+			return nil, newFormatError("unsupported time format %{" + param + "}t")
+		case name == "T" && param != "":
+			field = apacheDurationUnits[param]
+		case param == "":
+			field = apacheDirectives[name]
+		}
+
+		if field == fieldTime {
+			// Apache %t includes the surrounding square brackets
+			parser.addLiteral("[")
+			err = parser.addField(field, "%"+name)
+			parser.addLiteral("]")
+		} else {
+			err = parser.addField(field, "%"+name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = parser.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return parser, nil
+}
+
+// NewNginxFormatParser builds a FormatParser from an nginx log_format string
+func NewNginxFormatParser(format string) (parser *FormatParser, err error) {
+	parser = &FormatParser{}
+
+	for len(format) > 0 {
+		i := strings.Index(format, "$")
+		if i < 0 {
+			parser.addLiteral(format)
+			break
+		}
+		parser.addLiteral(format[:i])
+		format = format[i+1:]
+
+		var name string
+		if strings.HasPrefix(format, "{") {
+			j := strings.Index(format, "}")
+			if j < 0 {
+				return nil, newFormatError("unterminated variable")
+			}
+			name, format = format[1:j], format[j+1:]
+		} else {
+			j := 0
+			for j < len(format) && isNginxVariableChar(format[j]) {
+				j++
+			}
+			name, format = format[:j], format[j:]
+		}
+
+		if name == "" {
+			return nil, newFormatError("empty variable name")
+		}
+
+		err = parser.addField(nginxVariables[name], "$"+name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = parser.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return parser, nil
+}
+
+func isNginxVariableChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// addLiteral appends a literal token merging it with the previous literal if any
+func (parser *FormatParser) addLiteral(literal string) {
+	if literal == "" {
+		return
+	}
+	if len(parser.tokens) > 0 {
+		last := parser.tokens[len(parser.tokens)-1]
+		if last.isLiteral() {
+			last.literal += literal
+			return
+		}
+	}
+	parser.tokens = append(parser.tokens, &formatToken{literal: literal})
+}
+
+// addField appends a directive token
+// Two consecutive directives can't be split apart so they are rejected
+func (parser *FormatParser) addField(field formatField, name string) error {
+	if len(parser.tokens) > 0 {
+		last := parser.tokens[len(parser.tokens)-1]
+		if !last.isLiteral() {
+			return newFormatError("no separator between " + last.name + " and " + name)
+		}
+	}
+	parser.tokens = append(parser.tokens, &formatToken{field: field, name: name})
+	return nil
+}
+
+// validate ensures that the format provides the mandatory fields
+func (parser *FormatParser) validate() error {
+	for _, token := range parser.tokens {
+		switch token.field {
+		case fieldTime, fieldTimeISO8601, fieldTimeMsec:
+			return nil
+		}
+	}
+	return newFormatError("missing time directive")
+}
+
+// Parse a log line into a Request object according to the format
+func (parser *FormatParser) Parse(line string) (req *Request, err error) {
+
+	// Trim new lines
+
+	line = strings.TrimRight(line, "\r\n")
+
+	req = &Request{}
+	for i, token := range parser.tokens {
+		if token.isLiteral() {
+			if !strings.HasPrefix(line, token.literal) {
+				return nil, newParsingError("invalid line separator \"" + token.literal + "\" not found")
+			}
+			line = line[len(token.literal):]
+			continue
+		}
+
+		// The value of a directive spans until the next literal or the end of the line
+
+		value := line
+		if i+1 < len(parser.tokens) {
+			j := strings.Index(line, parser.tokens[i+1].literal)
+			if j < 0 {
+				return nil, newParsingError("invalid line separator \"" + parser.tokens[i+1].literal + "\" not found")
+			}
+			value = line[:j]
+		}
+		line = line[len(value):]
+
+		err = setField(req, token.field, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(line) > 0 {
+		return nil, newParsingError("invalid line trailing characters")
+	}
+
+	req.Section = parseSection(req.Path)
+
+	return req, nil
+}
+
+// setField parses the value and updates the matching Request field
+func setField(req *Request, field formatField, value string) (err error) {
+	switch field {
+	case fieldSourceIP:
+		req.SourceIP = net.ParseIP(value)
+		if req.SourceIP == nil {
+			return newParsingError("invalid ip")
+		}
+	case fieldUser:
+		req.User = value
+	case fieldTime:
+		req.Time, err = time.Parse(w3cDateLayout, value)
+		if err != nil {
+			return newParsingError("invalid date")
+		}
+	case fieldTimeISO8601:
+		req.Time, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return newParsingError("invalid date")
+		}
+	case fieldTimeMsec:
+		req.Time, err = parseEpoch(value, time.Second)
+		if err != nil {
+			return newParsingError("invalid date")
+		}
+	case fieldRequest:
+		parts := strings.Split(value, " ")
+		if len(parts) != 3 {
+			return newParsingError("invalid request")
+		}
+		req.Method, req.Path, req.HTTPVersion = parts[0], parts[1], parts[2]
+	case fieldMethod:
+		req.Method = value
+	case fieldPath:
+		req.Path = value
+	case fieldHTTPVersion:
+		req.HTTPVersion = value
+	case fieldCode:
+		req.Code, err = strconv.Atoi(value)
+		if err != nil {
+			return newParsingError("invalid code")
+		}
+	case fieldSize:
+		// Apache logs "-" instead of 0 when no bytes were sent
+		if value == "-" {
+			req.Size = 0
+			return nil
+		}
+		req.Size, err = strconv.Atoi(value)
+		if err != nil {
+			return newParsingError("invalid size")
+		}
+	case fieldReferrer:
+		req.Referrer = value
+	case fieldUserAgent:
+		req.UserAgent = value
+	case fieldTLSCipher:
+		req.TLSCipher = value
+	case fieldDurationSeconds:
+		return setDuration(req, value, time.Second)
+	case fieldDurationMilliseconds:
+		return setDuration(req, value, time.Millisecond)
+	case fieldDurationMicroseconds:
+		return setDuration(req, value, time.Microsecond)
+	case fieldUpstreamDuration:
+		// nginx logs one value per upstream server contacted and "-" if none
+		req.UpstreamDuration = 0
+		for _, v := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ':' || r == ' ' }) {
+			if v == "-" {
+				continue
+			}
+			d, err := parseDecimalDuration(v, time.Second)
+			if err != nil {
+				return newParsingError("invalid upstream duration")
+			}
+			req.UpstreamDuration += d
+		}
+	}
+	return nil
+}
+
+// setDuration parses the request duration unless the value is unknown ( "-" )
+func setDuration(req *Request, value string, unit time.Duration) (err error) {
+	if value == "-" {
+		return nil
+	}
+	req.Duration, err = parseDecimalDuration(value, unit)
+	if err != nil {
+		return newParsingError("invalid duration")
+	}
+	req.HasDuration = true
+	return nil
+}
+
+// parseDecimalDuration parses a decimal number of units
+func parseDecimalDuration(value string, unit time.Duration) (time.Duration, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if f < 0 {
+		return 0, fmt.Errorf("negative duration %s", value)
+	}
+	return time.Duration(f * float64(unit)), nil
+}
+
+// parseEpoch parses a decimal number of units since the unix epoch
+func parseEpoch(value string, unit time.Duration) (t time.Time, err error) {
+	i := strings.Index(value, ".")
+	if i < 0 {
+		i = len(value)
+	}
+
+	integer, err := strconv.ParseInt(value[:i], 10, 64)
+	if err != nil {
+		return t, err
+	}
+
+	var fraction float64
+	if i < len(value) {
+		fraction, err = strconv.ParseFloat("0"+value[i:], 64)
+		if err != nil {
+			return t, err
+		}
+	}
+
+	nsec := integer*int64(unit) + int64(fraction*float64(unit))
+	return time.Unix(0, nsec).UTC(), nil
+}
+
+func newFormatError(detail interface{}) error {
+	return fmt.Errorf("log format Error : %s", detail)
+}
@@ -0,0 +1,169 @@
+package accessmon
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewApacheFormatParser(t *testing.T) {
+	parser, err := NewApacheFormatParser("%h %l %u %t \"%r\" %>s %b")
+	require.NoError(t, err)
+	require.Len(t, parser.tokens, 13)
+
+	inputs := []string{
+		"",
+		"%h %l %u \"%r\" %>s %b",
+		"%h %l %u %t \"%r\" %>s%b",
+		"%h %l %u %{%d/%b/%Y}t \"%r\" %>s %b",
+		"%h %l %u %t %",
+		"%h %l %u %t %{Referer",
+	}
+
+	for _, input := range inputs {
+		_, err := NewApacheFormatParser(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestNewNginxFormatParser(t *testing.T) {
+	parser, err := NewNginxFormatParser("$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent")
+	require.NoError(t, err)
+	require.Len(t, parser.tokens, 11)
+
+	inputs := []string{
+		"",
+		"$remote_addr - $remote_user \"$request\" $status $body_bytes_sent",
+		"$remote_addr - $remote_user [$time_local] \"$request\" $status$body_bytes_sent",
+		"$remote_addr - $remote_user [$time_local] \"$request\" $ $status",
+		"$remote_addr - $remote_user [$time_local] \"$request\" ${status",
+	}
+
+	for _, input := range inputs {
+		_, err := NewNginxFormatParser(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestFormatParser_ParseApache(t *testing.T) {
+	parser, err := NewApacheFormatParser("%h %l %u %t \"%r\" %>s %b \"%{Referer}i\" \"%{User-agent}i\" %D")
+	require.NoError(t, err)
+
+	req, err := parser.Parse("127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 - \"http://www.example.com/\" \"Mozilla/5.0 (X11; Linux x86_64)\" 1234\n")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", req.SourceIP.String())
+	require.Equal(t, "mary", req.User)
+	require.Equal(t, "09/May/2018:16:00:42 +0000", req.Time.Format(w3cDateLayout))
+	require.Equal(t, "POST", req.Method)
+	require.Equal(t, "/api/user", req.Path)
+	require.Equal(t, "/api", req.Section)
+	require.Equal(t, "HTTP/1.0", req.HTTPVersion)
+	require.Equal(t, 503, req.Code)
+	require.Equal(t, 0, req.Size)
+	require.Equal(t, "http://www.example.com/", req.Referrer)
+	require.Equal(t, "Mozilla/5.0 (X11; Linux x86_64)", req.UserAgent)
+	require.True(t, req.HasDuration)
+	require.Equal(t, 1234*time.Microsecond, req.Duration)
+}
+
+func TestFormatParser_ParseApacheDuration(t *testing.T) {
+	parser, err := NewApacheFormatParser("%t %T %{ms}T")
+	require.NoError(t, err)
+
+	req, err := parser.Parse("[09/May/2018:16:00:42 +0000] 2 1500")
+	require.NoError(t, err)
+	require.True(t, req.HasDuration)
+	require.Equal(t, 1500*time.Millisecond, req.Duration)
+
+	req, err = parser.Parse("[09/May/2018:16:00:42 +0000] 2 -")
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Second, req.Duration)
+
+	_, err = parser.Parse("[09/May/2018:16:00:42 +0000] 2 invalid")
+	require.Error(t, err)
+}
+
+func TestFormatParser_ParseApacheCommon(t *testing.T) {
+	parser, err := NewApacheFormatParser("%h %l %u %t \"%r\" %>s %b")
+	require.NoError(t, err)
+
+	line := "127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12"
+	req, err := parser.Parse(line)
+	require.NoError(t, err)
+	require.Equal(t, line, req.String())
+}
+
+func TestFormatParser_ParseNginx(t *testing.T) {
+	parser, err := NewNginxFormatParser("$remote_addr - $remote_user [$time_iso8601] \"$request_method ${uri} $server_protocol\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\" $request_time $upstream_response_time")
+	require.NoError(t, err)
+
+	req, err := parser.Parse("::1 - - [2018-05-09T16:00:42+00:00] \"GET /www/index.html HTTP/2.0\" 200 42 \"-\" \"curl/7.64.0\" 0.012 0.010")
+	require.NoError(t, err)
+	require.Equal(t, "::1", req.SourceIP.String())
+	require.Equal(t, "-", req.User)
+	require.Equal(t, "09/May/2018:16:00:42 +0000", req.Time.Format(w3cDateLayout))
+	require.Equal(t, "GET", req.Method)
+	require.Equal(t, "/www/index.html", req.Path)
+	require.Equal(t, "/www", req.Section)
+	require.Equal(t, "HTTP/2.0", req.HTTPVersion)
+	require.Equal(t, 200, req.Code)
+	require.Equal(t, 42, req.Size)
+	require.Equal(t, "-", req.Referrer)
+	require.Equal(t, "curl/7.64.0", req.UserAgent)
+	require.True(t, req.HasDuration)
+	require.Equal(t, 12*time.Millisecond, req.Duration)
+	require.Equal(t, 10*time.Millisecond, req.UpstreamDuration)
+}
+
+func TestFormatParser_ParseNginxUpstream(t *testing.T) {
+	parser, err := NewNginxFormatParser("$time_local|$request_time|$upstream_response_time")
+	require.NoError(t, err)
+
+	req, err := parser.Parse("09/May/2018:16:00:42 +0000|0.150|0.050, 0.100")
+	require.NoError(t, err)
+	require.Equal(t, 150*time.Millisecond, req.Duration)
+	require.Equal(t, 150*time.Millisecond, req.UpstreamDuration)
+
+	req, err = parser.Parse("09/May/2018:16:00:42 +0000|0.000|-")
+	require.NoError(t, err)
+	require.True(t, req.HasDuration)
+	require.Equal(t, time.Duration(0), req.Duration)
+	require.Equal(t, time.Duration(0), req.UpstreamDuration)
+
+	_, err = parser.Parse("09/May/2018:16:00:42 +0000|-1|-")
+	require.Error(t, err)
+
+	_, err = parser.Parse("09/May/2018:16:00:42 +0000|0.1|invalid")
+	require.Error(t, err)
+}
+
+func TestFormatParser_ParseNginxMsec(t *testing.T) {
+	parser, err := NewNginxFormatParser("$msec $remote_addr \"$request\" $status")
+	require.NoError(t, err)
+
+	req, err := parser.Parse("1525881642.250 127.0.0.1 \"GET / HTTP/1.1\" 200")
+	require.NoError(t, err)
+	require.Equal(t, int64(1525881642), req.Time.Unix())
+	require.Equal(t, 250, req.Time.Nanosecond()/1000000)
+}
+
+func TestFormatParser_ParseError(t *testing.T) {
+	parser, err := NewApacheFormatParser("%h %l %u %t \"%r\" %>s %b")
+	require.NoError(t, err)
+
+	inputs := []string{
+		"",
+		"invalid - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 12",
+		"127.0.0.1 - mary [invalid] \"POST /api/user HTTP/1.0\" 503 12",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"invalid\" 503 12",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" invalid 12",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503 invalid",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000] \"POST /api/user HTTP/1.0\" 503",
+		"127.0.0.1 - mary [09/May/2018:16:00:42 +0000]",
+	}
+
+	for _, input := range inputs {
+		_, err := parser.Parse(input)
+		require.Error(t, err, input)
+	}
+}
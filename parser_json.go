@@ -0,0 +1,187 @@
+package accessmon
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+)
+
+// JSONParser is a Parser implementation for logs written as one JSON object per line
+// Caddy, Traefik and most structured loggers are able to produce such logs
+// {"ts":1525881642.25,"request":{"remote_ip":"127.0.0.1","method":"POST","uri":"/api/user","proto":"HTTP/1.0"},"status":503,"size":12}
+type JSONParser struct {
+	fields       []*jsonField
+	timeFormat   string
+	durationUnit time.Duration
+}
+
+// JSONFields maps the Request fields to the dotted path of the JSON keys holding them
+// ( "request.remote_ip" for {"request":{"remote_ip":"127.0.0.1"}} ). Empty paths are ignored
+type JSONFields struct {
+	SourceIP    string
+	User        string
+	Time        string // mandatory
+	Method      string
+	Path        string
+	HTTPVersion string
+	Code        string
+	Size        string
+	Referrer    string
+	UserAgent   string
+	Request     string // full request line "METHOD PATH PROTOCOL"
+	Duration    string // decimal number of DurationUnit
+
+	DurationUnit time.Duration // time.Second by default
+}
+
+// Special time formats for JSONParser
+const (
+	TimeFormatEpoch      = "epoch"    // seconds since the unix epoch
+	TimeFormatEpochMilli = "epoch_ms" // milliseconds since the unix epoch
+)
+
+// jsonField holds a parsed dotted path and the Request field to update
+type jsonField struct {
+	path  []string
+	field formatField
+}
+
+// NewJSONParser builds a JSONParser from the field mapping and the time format
+// The time format is either TimeFormatEpoch, TimeFormatEpochMilli or a time.Parse layout ( time.RFC3339 by default )
+func NewJSONParser(fields *JSONFields, timeFormat string) (parser *JSONParser, err error) {
+	if fields.Time == "" {
+		return nil, newFormatError("missing time field")
+	}
+
+	if timeFormat == "" {
+		timeFormat = time.RFC3339
+	}
+
+	durationUnit := fields.DurationUnit
+	if durationUnit <= 0 {
+		durationUnit = time.Second
+	}
+
+	parser = &JSONParser{timeFormat: timeFormat, durationUnit: durationUnit}
+
+	// Request should come first so that Method, Path and HTTPVersion can override it
+
+	mapping := []struct {
+		path  string
+		field formatField
+	}{
+		{fields.Request, fieldRequest},
+		{fields.SourceIP, fieldSourceIP},
+		{fields.User, fieldUser},
+		{fields.Time, fieldTime},
+		{fields.Method, fieldMethod},
+		{fields.Path, fieldPath},
+		{fields.HTTPVersion, fieldHTTPVersion},
+		{fields.Code, fieldCode},
+		{fields.Size, fieldSize},
+		{fields.Referrer, fieldReferrer},
+		{fields.UserAgent, fieldUserAgent},
+		{fields.Duration, fieldDurationSeconds},
+	}
+
+	for _, m := range mapping {
+		if m.path == "" {
+			continue
+		}
+		parser.fields = append(parser.fields, &jsonField{path: strings.Split(m.path, "."), field: m.field})
+	}
+
+	return parser, nil
+}
+
+// Parse a JSON log line into a Request object
+func (parser *JSONParser) Parse(line string) (req *Request, err error) {
+	var object map[string]interface{}
+
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	err = decoder.Decode(&object)
+	if err != nil {
+		return nil, newParsingError("invalid json")
+	}
+
+	req = &Request{}
+	for _, field := range parser.fields {
+		value, ok := lookupJSON(object, field.path)
+		if !ok {
+			if field.field == fieldTime {
+				return nil, newParsingError("missing time")
+			}
+			continue
+		}
+
+		switch field.field {
+		case fieldTime:
+			req.Time, err = parser.parseTime(value)
+			if err != nil {
+				return nil, newParsingError("invalid date")
+			}
+		case fieldSourceIP:
+			// Some servers log the remote address with its port
+			if host, _, err := net.SplitHostPort(value); err == nil {
+				value = host
+			}
+			err = setField(req, field.field, value)
+		case fieldDurationSeconds:
+			err = setDuration(req, value, parser.durationUnit)
+		default:
+			err = setField(req, field.field, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req.Section = parseSection(req.Path)
+
+	return req, nil
+}
+
+func (parser *JSONParser) parseTime(value string) (time.Time, error) {
+	switch parser.timeFormat {
+	case TimeFormatEpoch:
+		return parseEpoch(value, time.Second)
+	case TimeFormatEpochMilli:
+		return parseEpoch(value, time.Millisecond)
+	default:
+		return time.Parse(parser.timeFormat, value)
+	}
+}
+
+// lookupJSON walks the decoded JSON object along the path and returns the value as a string
+// Arrays ( like multi-valued headers ) are reduced to their first element
+func lookupJSON(object map[string]interface{}, path []string) (value string, ok bool) {
+	var current interface{} = object
+	for _, key := range path {
+		node, isObject := current.(map[string]interface{})
+		if !isObject {
+			return "", false
+		}
+		current, ok = node[key]
+		if !ok {
+			return "", false
+		}
+	}
+
+	if array, isArray := current.([]interface{}); isArray {
+		if len(array) == 0 {
+			return "", false
+		}
+		current = array[0]
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,120 @@
+package accessmon
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewJSONParser(t *testing.T) {
+	_, err := NewJSONParser(&JSONFields{}, "")
+	require.Error(t, err)
+
+	parser, err := NewJSONParser(&JSONFields{Time: "ts", Code: "status"}, "")
+	require.NoError(t, err)
+	require.Len(t, parser.fields, 2)
+	require.Equal(t, time.RFC3339, parser.timeFormat)
+}
+
+func TestJSONParser_Parse(t *testing.T) {
+	fields := &JSONFields{
+		SourceIP:    "request.remote_addr",
+		User:        "user_id",
+		Time:        "ts",
+		Method:      "request.method",
+		Path:        "request.uri",
+		HTTPVersion: "request.proto",
+		Code:        "status",
+		Size:        "size",
+		Referrer:    "request.headers.Referer",
+		UserAgent:   "request.headers.User-Agent",
+	}
+	parser, err := NewJSONParser(fields, TimeFormatEpoch)
+	require.NoError(t, err)
+
+	_, err = parser.Parse("")
+	require.Errorf(t, err, "missing error")
+
+	req, err := parser.Parse(`{"ts":1525881642.25,"request":{"remote_addr":"127.0.0.1:51234","method":"POST","uri":"/api/user","proto":"HTTP/1.0","headers":{"User-Agent":["curl/7.64.0"]}},"user_id":"mary","status":503,"size":12}`)
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", req.SourceIP.String())
+	require.Equal(t, "mary", req.User)
+	require.Equal(t, "09/May/2018:16:00:42 +0000", req.Time.Format(w3cDateLayout))
+	require.Equal(t, 250*time.Millisecond, time.Duration(req.Time.Nanosecond()))
+	require.Equal(t, "POST", req.Method)
+	require.Equal(t, "/api/user", req.Path)
+	require.Equal(t, "/api", req.Section)
+	require.Equal(t, "HTTP/1.0", req.HTTPVersion)
+	require.Equal(t, 503, req.Code)
+	require.Equal(t, 12, req.Size)
+	require.Equal(t, "", req.Referrer)
+	require.Equal(t, "curl/7.64.0", req.UserAgent)
+}
+
+func TestJSONParser_ParseRequestLine(t *testing.T) {
+	parser, err := NewJSONParser(&JSONFields{Time: "time", Request: "request", Code: "status", SourceIP: "ip"}, "")
+	require.NoError(t, err)
+
+	req, err := parser.Parse(`{"time":"2018-05-09T16:00:42+00:00","request":"GET /www/index.html HTTP/2.0","status":"200","ip":"::1"}`)
+	require.NoError(t, err)
+	require.Equal(t, "::1", req.SourceIP.String())
+	require.Equal(t, "09/May/2018:16:00:42 +0000", req.Time.Format(w3cDateLayout))
+	require.Equal(t, "GET", req.Method)
+	require.Equal(t, "/www", req.Section)
+	require.Equal(t, "HTTP/2.0", req.HTTPVersion)
+	require.Equal(t, 200, req.Code)
+}
+
+func TestJSONParser_ParseDuration(t *testing.T) {
+	parser, err := NewJSONParser(&JSONFields{Time: "ts", Duration: "duration"}, TimeFormatEpoch)
+	require.NoError(t, err)
+
+	req, err := parser.Parse(`{"ts":1525881642,"duration":0.012}`)
+	require.NoError(t, err)
+	require.True(t, req.HasDuration)
+	require.Equal(t, 12*time.Millisecond, req.Duration)
+
+	req, err = parser.Parse(`{"ts":1525881642}`)
+	require.NoError(t, err)
+	require.False(t, req.HasDuration)
+
+	parser, err = NewJSONParser(&JSONFields{Time: "ts", Duration: "Duration", DurationUnit: time.Nanosecond}, TimeFormatEpoch)
+	require.NoError(t, err)
+
+	req, err = parser.Parse(`{"ts":1525881642,"Duration":12000000}`)
+	require.NoError(t, err)
+	require.Equal(t, 12*time.Millisecond, req.Duration)
+
+	_, err = parser.Parse(`{"ts":1525881642,"Duration":"invalid"}`)
+	require.Error(t, err)
+}
+
+func TestJSONParser_ParseEpochMilli(t *testing.T) {
+	parser, err := NewJSONParser(&JSONFields{Time: "ts"}, TimeFormatEpochMilli)
+	require.NoError(t, err)
+
+	req, err := parser.Parse(`{"ts":1525881642250}`)
+	require.NoError(t, err)
+	require.Equal(t, "09/May/2018:16:00:42 +0000", req.Time.Format(w3cDateLayout))
+	require.Equal(t, 250*time.Millisecond, time.Duration(req.Time.Nanosecond()))
+}
+
+func TestJSONParser_ParseError(t *testing.T) {
+	parser, err := NewJSONParser(&JSONFields{Time: "time", Code: "status", SourceIP: "ip", Request: "request"}, "")
+	require.NoError(t, err)
+
+	inputs := []string{
+		`invalid`,
+		`{"status":200}`,
+		`{"time":{"nested":true}}`,
+		`{"time":"invalid"}`,
+		`{"time":"2018-05-09T16:00:42+00:00","status":"invalid"}`,
+		`{"time":"2018-05-09T16:00:42+00:00","ip":"invalid"}`,
+		`{"time":"2018-05-09T16:00:42+00:00","request":"invalid"}`,
+	}
+
+	for _, input := range inputs {
+		_, err := parser.Parse(input)
+		require.Error(t, err, input)
+	}
+}
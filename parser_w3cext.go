@@ -0,0 +1,149 @@
+package accessmon
+
+import (
+	"strings"
+	"time"
+)
+
+// W3CExtendedParser is a stateful Parser implementation for the W3C Extended Log File Format
+// used by IIS and CloudFront. The columns are declared by the #Fields directive
+// and the mapping is updated each time a new directive is found in the stream
+// see : https://www.w3.org/TR/WD-logfile.html
+// #Fields: date time c-ip cs-username cs-method cs-uri-stem cs-uri-query sc-status sc-bytes cs-version
+// 2018-05-09 16:00:42 127.0.0.1 mary POST /api/user - 503 12 HTTP/1.0
+type W3CExtendedParser struct {
+	fields []formatField // Request field of each column
+
+	date int // index of the date column
+	time int // index of the time column
+}
+
+// w3cExtendedFields maps W3C Extended field identifiers to Request fields
+// Identifiers that are not listed here are parsed but ignored
+var w3cExtendedFields = map[string]formatField{
+	"c-ip":                fieldSourceIP,
+	"cs-username":         fieldUser,
+	"cs-method":           fieldMethod,
+	"cs-uri-stem":         fieldPath,
+	"cs-uri":              fieldPath,
+	"cs-version":          fieldHTTPVersion,
+	"cs-protocol-version": fieldHTTPVersion,
+	"sc-status":           fieldCode,
+	"sc-bytes":            fieldSize,
+	"cs(referer)":         fieldReferrer,
+	"cs(user-agent)":      fieldUserAgent,
+	"ssl-cipher":          fieldTLSCipher,
+	"time-taken":          fieldDurationMilliseconds,
+}
+
+const (
+	w3cExtendedDateLayout = "2006-01-02"
+	w3cExtendedTimeLayout = "15:04:05"
+)
+
+// Parse a W3C Extended Log Format line into a Request object
+// Directive lines update the parser state and return a nil Request
+func (parser *W3CExtendedParser) Parse(line string) (req *Request, err error) {
+
+	// Trim new lines
+
+	line = strings.TrimRight(line, "\r\n")
+
+	// Directives
+
+	if strings.HasPrefix(line, "#") {
+		return nil, parser.parseDirective(line)
+	}
+
+	if parser.fields == nil {
+		return nil, newParsingError("missing #Fields directive")
+	}
+
+	// Split
+
+	values := strings.Fields(line)
+	if len(values) != len(parser.fields) {
+		return nil, newParsingError("invalid line field count mismatch")
+	}
+
+	// Parse
+
+	req = &Request{}
+
+	date, err := time.Parse(w3cExtendedDateLayout+" "+w3cExtendedTimeLayout, values[parser.date]+" "+values[parser.time])
+	if err != nil {
+		return nil, newParsingError("invalid date")
+	}
+	req.Time = date
+
+	query := ""
+	for i, value := range values {
+		if value == "-" {
+			continue
+		}
+		field := parser.fields[i]
+		switch field {
+		case fieldQuery:
+			query = value
+			continue
+		case fieldDurationMilliseconds:
+			// IIS logs time-taken in milliseconds and CloudFront in seconds with a millisecond resolution
+			if strings.Contains(value, ".") {
+				field = fieldDurationSeconds
+			}
+		}
+		err = setField(req, field, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if query != "" {
+		req.Path += "?" + query
+	}
+	req.Section = parseSection(req.Path)
+
+	return req, nil
+}
+
+// parseDirective handles the #Version, #Fields, #Software, #Date, ... directives
+func (parser *W3CExtendedParser) parseDirective(line string) (err error) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return newParsingError("invalid directive")
+	}
+	directive, value := line[1:i], strings.TrimSpace(line[i+1:])
+
+	switch directive {
+	case "Version":
+		if value != "1.0" {
+			return newParsingError("unsupported version " + value)
+		}
+	case "Fields":
+		fields := strings.Fields(value)
+		date, clock := -1, -1
+		mapping := make([]formatField, len(fields))
+		for j, field := range fields {
+			field = strings.ToLower(field)
+			switch field {
+			case "date":
+				date = j
+			case "time":
+				clock = j
+			case "cs-uri-query":
+				mapping[j] = fieldQuery
+			default:
+				mapping[j] = w3cExtendedFields[field]
+			}
+		}
+		if date < 0 || clock < 0 {
+			parser.fields = nil
+			return newParsingError("missing date or time field")
+		}
+		parser.fields, parser.date, parser.time = mapping, date, clock
+	}
+
+	// Other directives are informative only
+
+	return nil
+}
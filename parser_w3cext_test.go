@@ -0,0 +1,100 @@
+package accessmon
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestW3CExtendedParser_Parse(t *testing.T) {
+	parser := &W3CExtendedParser{}
+
+	_, err := parser.Parse("2018-05-09 16:00:42 127.0.0.1 mary POST /api/user - 503 12 HTTP/1.0")
+	require.Error(t, err)
+
+	lines := []string{
+		"#Software: Microsoft Internet Information Services 10.0",
+		"#Version: 1.0",
+		"#Date: 2018-05-09 16:00:00",
+		"#Fields: date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) sc-status sc-substatus sc-win32-status sc-bytes time-taken",
+	}
+	for _, line := range lines {
+		req, err := parser.Parse(line)
+		require.NoError(t, err, line)
+		require.Nil(t, req)
+	}
+
+	req, err := parser.Parse("2018-05-09 16:00:42 10.0.0.1 POST /api/user id=1 443 mary 127.0.0.1 Mozilla/5.0+(Windows+NT+10.0) - 503 0 0 12 15\r\n")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", req.SourceIP.String())
+	require.Equal(t, "mary", req.User)
+	require.Equal(t, time.Date(2018, time.May, 9, 16, 0, 42, 0, time.UTC), req.Time)
+	require.Equal(t, "POST", req.Method)
+	require.Equal(t, "/api/user?id=1", req.Path)
+	require.Equal(t, "/api", req.Section)
+	require.Equal(t, 503, req.Code)
+	require.Equal(t, 12, req.Size)
+	require.Equal(t, "", req.Referrer)
+	require.Equal(t, "Mozilla/5.0+(Windows+NT+10.0)", req.UserAgent)
+	require.True(t, req.HasDuration)
+	require.Equal(t, 15*time.Millisecond, req.Duration)
+}
+
+func TestW3CExtendedParser_ParseFieldsChange(t *testing.T) {
+	parser := &W3CExtendedParser{}
+
+	_, err := parser.Parse("#Fields: date time c-ip cs-method cs-uri-stem sc-status")
+	require.NoError(t, err)
+
+	req, err := parser.Parse("2018-05-09 16:00:42 127.0.0.1 GET /www/index.html 200")
+	require.NoError(t, err)
+	require.Equal(t, "/www", req.Section)
+	require.Equal(t, 200, req.Code)
+
+	// CloudFront like columns separated by tabs
+
+	_, err = parser.Parse("#Fields: date\ttime\tx-edge-location\tsc-bytes\tc-ip\tcs-method\tcs-uri-stem\tsc-status\ttime-taken\tcs-protocol-version\tssl-cipher")
+	require.NoError(t, err)
+
+	req, err = parser.Parse("2018-05-09\t16:00:43\tCDG50-C1\t1024\t::1\tGET\t/static/app.js\t304\t0.002\tHTTP/2.0\tECDHE-RSA-AES128-GCM-SHA256")
+	require.NoError(t, err)
+	require.Equal(t, "::1", req.SourceIP.String())
+	require.Equal(t, "/static", req.Section)
+	require.Equal(t, 304, req.Code)
+	require.Equal(t, 1024, req.Size)
+	require.Equal(t, "HTTP/2.0", req.HTTPVersion)
+	require.Equal(t, 2*time.Millisecond, req.Duration)
+	require.Equal(t, "ECDHE-RSA-AES128-GCM-SHA256", req.TLSCipher)
+}
+
+func TestW3CExtendedParser_ParseError(t *testing.T) {
+	parser := &W3CExtendedParser{}
+
+	directives := []string{
+		"#Version: 2.0",
+		"#Fields: time c-ip",
+		"#Fields date time",
+	}
+
+	for _, input := range directives {
+		_, err := parser.Parse(input)
+		require.Error(t, err, input)
+	}
+
+	_, err := parser.Parse("#Fields: date time c-ip sc-status")
+	require.NoError(t, err)
+
+	inputs := []string{
+		"",
+		"2018-05-09 16:00:42 127.0.0.1",
+		"2018-05-09 16:00:42 127.0.0.1 200 extra",
+		"invalid 16:00:42 127.0.0.1 200",
+		"2018-05-09 16:00:42 invalid 200",
+		"2018-05-09 16:00:42 127.0.0.1 invalid",
+	}
+
+	for _, input := range inputs {
+		_, err := parser.Parse(input)
+		require.Error(t, err, input)
+	}
+}
@@ -0,0 +1,301 @@
+package accessmon
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrometheusExporter exposes the request counters, the latency histograms and the alert states
+// in the Prometheus text exposition format. It must be registered as both an Observer and a Notifier
+// see : https://prometheus.io/docs/instrumenting/exposition_formats/
+type PrometheusExporter struct {
+	lock sync.Mutex
+
+	requests map[requestLabels]float64 // requests by status class, method, section, HTTP version and IP family
+	bytes    map[string]float64        // response bytes by section
+	latency  map[string]*histogram     // request durations by section
+	alerts   map[alertLabels]float64   // 1 if the alert is ongoing
+	sections map[string]bool           // sections exported with their own label value
+	lines    float64
+	errors   float64
+}
+
+// The label values taken from the logs are bounded so that a scan or a crawler
+// can't blow up the number of time series, the rest is reported as otherLabel
+const (
+	prometheusMaxSections = 100
+	otherLabel            = "other"
+)
+
+// httpMethods are the methods exported with their own label value
+var httpMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true,
+	"CONNECT": true, "OPTIONS": true, "TRACE": true, "PATCH": true,
+}
+
+// httpVersions are the protocol versions exported with their own label value ( empty if not logged )
+var httpVersions = map[string]bool{
+	"": true, "HTTP/0.9": true, "HTTP/1.0": true, "HTTP/1.1": true,
+	"HTTP/2": true, "HTTP/2.0": true, "HTTP/3": true, "HTTP/3.0": true,
+}
+
+type requestLabels struct {
+	class   string
+	method  string
+	section string
+	version string
+	family  string
+}
+
+type alertLabels struct {
+	rule     string
+	severity string
+	section  string
+}
+
+// latencyBuckets are the upper bounds in seconds of the latency histogram buckets
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram is a cumulative Prometheus histogram
+type histogram struct {
+	counts []float64 // count of observations lower or equal to the bucket upper bound
+	count  float64
+	sum    float64
+}
+
+// NewPrometheusExporter builds an empty PrometheusExporter
+func NewPrometheusExporter() *PrometheusExporter {
+	return &PrometheusExporter{
+		requests: make(map[requestLabels]float64),
+		bytes:    make(map[string]float64),
+		latency:  make(map[string]*histogram),
+		alerts:   make(map[alertLabels]float64),
+		sections: make(map[string]bool),
+	}
+}
+
+// Observe updates the counters with the processed line
+func (exporter *PrometheusExporter) Observe(req *Request, err error) {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+
+	exporter.lines++
+	if err != nil {
+		exporter.errors++
+	}
+	if req == nil {
+		return
+	}
+
+	family := "ipv4"
+	if req.IsIPv6() {
+		family = "ipv6"
+	}
+	method := req.Method
+	if !httpMethods[method] {
+		method = otherLabel
+	}
+	version := req.HTTPVersion
+	if !httpVersions[version] {
+		version = otherLabel
+	}
+	section := exporter.section(req.Section)
+
+	labels := requestLabels{
+		class:   fmt.Sprintf("%dxx", req.CodeClass()),
+		method:  method,
+		section: section,
+		version: version,
+		family:  family,
+	}
+	exporter.requests[labels]++
+	exporter.bytes[section] += float64(req.Size)
+
+	if req.HasDuration {
+		h, ok := exporter.latency[section]
+		if !ok {
+			h = &histogram{counts: make([]float64, len(latencyBuckets))}
+			exporter.latency[section] = h
+		}
+		h.observe(req.Duration.Seconds())
+	}
+}
+
+// section returns the label value of the section, the first prometheusMaxSections sections
+// seen get their own value
+func (exporter *PrometheusExporter) section(section string) string {
+	if exporter.sections[section] {
+		return section
+	}
+	if len(exporter.sections) >= prometheusMaxSections {
+		return otherLabel
+	}
+	exporter.sections[section] = true
+	return section
+}
+
+// Notify updates the alert states
+func (exporter *PrometheusExporter) Notify(alert *Alert) {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+
+	labels := alertLabels{rule: alert.Rule, severity: alert.Severity, section: alert.Section}
+	switch {
+	case alert.IsOngoing():
+		exporter.alerts[labels] = 1
+	case alert.Section != "":
+		// The per section alerts are removed once closed as the sections come and go
+		delete(exporter.alerts, labels)
+	default:
+		exporter.alerts[labels] = 0
+	}
+}
+
+// Close does nothing, there is nothing to flush
+func (exporter *PrometheusExporter) Close() {}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (exporter *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	writer := bufio.NewWriter(w)
+	exporter.write(writer)
+	_ = writer.Flush()
+}
+
+func (exporter *PrometheusExporter) write(w *bufio.Writer) {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+
+	// Requests
+
+	writeHeader(w, "accessmon_requests_total", "counter", "Number of requests by status class, method, section, HTTP version and IP family.")
+	var requests []requestLabels
+	for labels := range exporter.requests {
+		requests = append(requests, labels)
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].less(requests[j]) })
+	for _, labels := range requests {
+		writeSample(w, "accessmon_requests_total", exporter.requests[labels],
+			"class", labels.class, "method", labels.method, "section", labels.section, "version", labels.version, "family", labels.family)
+	}
+
+	// Bytes
+
+	writeHeader(w, "accessmon_response_bytes_total", "counter", "Number of response bytes by section.")
+	for _, section := range sortedKeys(exporter.bytes) {
+		writeSample(w, "accessmon_response_bytes_total", exporter.bytes[section], "section", section)
+	}
+
+	// Latency
+
+	writeHeader(w, "accessmon_request_duration_seconds", "histogram", "Request duration by section, for the log formats providing it.")
+	var sections []string
+	for section := range exporter.latency {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		h := exporter.latency[section]
+		for i, bound := range latencyBuckets {
+			writeSample(w, "accessmon_request_duration_seconds_bucket", h.counts[i], "section", section, "le", formatFloat(bound))
+		}
+		writeSample(w, "accessmon_request_duration_seconds_bucket", h.count, "section", section, "le", "+Inf")
+		writeSample(w, "accessmon_request_duration_seconds_sum", h.sum, "section", section)
+		writeSample(w, "accessmon_request_duration_seconds_count", h.count, "section", section)
+	}
+
+	// Alerts
+
+	writeHeader(w, "accessmon_alert_active", "gauge", "1 if the alert of the rule is ongoing, rules that never raised an alert are not reported.")
+	var alerts []alertLabels
+	for labels := range exporter.alerts {
+		alerts = append(alerts, labels)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].less(alerts[j]) })
+	for _, labels := range alerts {
+		writeSample(w, "accessmon_alert_active", exporter.alerts[labels], "rule", labels.rule, "severity", labels.severity, "section", labels.section)
+	}
+
+	// Self monitoring
+
+	writeHeader(w, "accessmon_lines_total", "counter", "Number of log lines processed.")
+	writeSample(w, "accessmon_lines_total", exporter.lines)
+	writeHeader(w, "accessmon_parse_errors_total", "counter", "Number of log lines that could not be processed.")
+	writeSample(w, "accessmon_parse_errors_total", exporter.errors)
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range latencyBuckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (labels requestLabels) less(other requestLabels) bool {
+	a := []string{labels.section, labels.class, labels.method, labels.version, labels.family}
+	b := []string{other.section, other.class, other.method, other.version, other.family}
+	return strings.Join(a, "\x00") < strings.Join(b, "\x00")
+}
+
+func (labels alertLabels) less(other alertLabels) bool {
+	a := []string{labels.rule, labels.section, labels.severity}
+	b := []string{other.rule, other.section, other.severity}
+	return strings.Join(a, "\x00") < strings.Join(b, "\x00")
+}
+
+func sortedKeys(m map[string]float64) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeHeader(w *bufio.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes a sample line, the labels are provided as name, value pairs
+func writeSample(w *bufio.Writer, name string, value float64, labels ...string) {
+	_, _ = w.WriteString(name)
+	if len(labels) > 0 {
+		_ = w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				_ = w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		_ = w.WriteByte('}')
+	}
+	fmt.Fprintf(w, " %s\n", formatFloat(value))
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
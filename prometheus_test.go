@@ -0,0 +1,107 @@
+package accessmon
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusExporter(t *testing.T) {
+	exporter := NewPrometheusExporter()
+	mon, err := NewMonitor(&Config{
+		AlertWindow:    time.Second,
+		AlertThreshold: 1,
+		Observers:      []Observer{exporter},
+		Notifiers:      []Notifier{exporter},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		for _, ip := range []string{"127.0.0.1", "::1", "127.0.0.1"} {
+			req := &Request{SourceIP: net.ParseIP(ip), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: "/api/user", HTTPVersion: "HTTP/1.1", Code: 200, Size: 10}
+			_, err := mon.AddLine(req.String())
+			require.NoError(t, err)
+		}
+	}
+	_, err = mon.AddLine("invalid")
+	require.Error(t, err)
+
+	recorder := httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	require.Contains(t, body, "# TYPE accessmon_requests_total counter\n")
+	require.Contains(t, body, `accessmon_requests_total{class="2xx",method="GET",section="/api",version="HTTP/1.1",family="ipv4"} 6`+"\n")
+	require.Contains(t, body, `accessmon_requests_total{class="2xx",method="GET",section="/api",version="HTTP/1.1",family="ipv6"} 3`+"\n")
+	require.Contains(t, body, `accessmon_response_bytes_total{section="/api"} 90`+"\n")
+	require.Contains(t, body, `accessmon_alert_active{rule="high_traffic",severity="",section=""} 1`+"\n")
+	require.Contains(t, body, "accessmon_lines_total 10\n")
+	require.Contains(t, body, "accessmon_parse_errors_total 1\n")
+	require.NotContains(t, body, "accessmon_request_duration_seconds_bucket")
+}
+
+func TestPrometheusExporter_Latency(t *testing.T) {
+	exporter := NewPrometheusExporter()
+	for _, duration := range []time.Duration{3 * time.Millisecond, 200 * time.Millisecond, 20 * time.Second} {
+		exporter.Observe(&Request{Section: "/api", Duration: duration, HasDuration: true}, nil)
+	}
+
+	recorder := httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	require.Contains(t, body, "# TYPE accessmon_request_duration_seconds histogram\n")
+	require.Contains(t, body, `accessmon_request_duration_seconds_bucket{section="/api",le="0.005"} 1`+"\n")
+	require.Contains(t, body, `accessmon_request_duration_seconds_bucket{section="/api",le="0.25"} 2`+"\n")
+	require.Contains(t, body, `accessmon_request_duration_seconds_bucket{section="/api",le="10"} 2`+"\n")
+	require.Contains(t, body, `accessmon_request_duration_seconds_bucket{section="/api",le="+Inf"} 3`+"\n")
+	require.Contains(t, body, `accessmon_request_duration_seconds_sum{section="/api"} 20.203`+"\n")
+	require.Contains(t, body, `accessmon_request_duration_seconds_count{section="/api"} 3`+"\n")
+}
+
+func TestPrometheusExporter_Cardinality(t *testing.T) {
+	exporter := NewPrometheusExporter()
+	for i := 0; i < prometheusMaxSections+10; i++ {
+		exporter.Observe(&Request{SourceIP: net.ParseIP("127.0.0.1"), Method: "GET", Section: fmt.Sprintf("/s%d", i), HTTPVersion: "HTTP/1.1", Code: 200, Size: 1}, nil)
+	}
+	exporter.Observe(&Request{SourceIP: net.ParseIP("127.0.0.1"), Method: "BREW", Section: "/s0", HTTPVersion: "HTTP/1.1", Code: 200, Size: 1}, nil)
+	exporter.Observe(&Request{SourceIP: net.ParseIP("127.0.0.1"), Method: "GET", Section: "/s1", HTTPVersion: "HTTP/9.9-scan", Code: 200, Size: 1}, nil)
+
+	recorder := httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	require.Contains(t, body, `accessmon_response_bytes_total{section="/s0"} 2`+"\n")
+	require.Contains(t, body, `accessmon_response_bytes_total{section="other"} 10`+"\n")
+	require.NotContains(t, body, `section="/s100"`)
+	require.Contains(t, body, `accessmon_requests_total{class="2xx",method="other",section="/s0",version="HTTP/1.1",family="ipv4"} 1`+"\n")
+	require.Contains(t, body, `accessmon_requests_total{class="2xx",method="GET",section="/s1",version="other",family="ipv4"} 1`+"\n")
+	require.Len(t, exporter.bytes, prometheusMaxSections+1)
+}
+
+func TestPrometheusExporter_SectionAlerts(t *testing.T) {
+	exporter := NewPrometheusExporter()
+
+	alert := &Alert{Rule: "section_traffic", Section: "/api", Start: start}
+	exporter.Notify(alert)
+	require.Len(t, exporter.alerts, 1)
+
+	// Closed per section alerts are removed, the global ones are kept at 0
+
+	alert.End = start.Add(time.Minute)
+	exporter.Notify(alert)
+	require.Len(t, exporter.alerts, 0)
+
+	alert = &Alert{Rule: "high_traffic", Start: start, End: start.Add(time.Minute)}
+	exporter.Notify(alert)
+	require.Equal(t, float64(0), exporter.alerts[alertLabels{rule: "high_traffic"}])
+}
+
+func TestEscapeLabel(t *testing.T) {
+	require.Equal(t, `a\\b\"c\nd`, escapeLabel("a\\b\"c\nd"))
+}
@@ -0,0 +1,38 @@
+package accessmon
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// StatsPusher pushes the Stats of each refresh interval to a metrics backend
+type StatsPusher interface {
+	// Push sends the stats of the requests received during the window ending at now
+	Push(stats *Stats, now time.Time, window time.Duration) error
+
+	// Close releases the resources
+	Close() error
+}
+
+var metricInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// sectionName converts a section to a metric name component ( "/api" to "api", "/" to "root" )
+func sectionName(section string) string {
+	name := strings.Trim(metricInvalidChars.ReplaceAllString(section, "_"), "_")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
+
+func perSecond(count int, window time.Duration) float64 {
+	if window <= 0 {
+		return 0
+	}
+	return float64(count) / window.Seconds()
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -18,6 +18,16 @@ type Request struct {
 	HTTPVersion string
 	Code        int
 	Size        int
+	Referrer    string
+	UserAgent   string
+
+	Duration    time.Duration // time taken to serve the request
+	HasDuration bool          // true if the log format provides the request Duration
+
+	UpstreamAddr     string        // address of the backend that served the request
+	UpstreamCode     int           // status code returned by the backend
+	UpstreamDuration time.Duration // time spent by the backend processing the request
+	TLSCipher        string
 }
 
 // IsHTTP2 returns if the request is a HTTP/2.0 request
@@ -38,6 +48,11 @@ func (req *Request) IsServerError() bool {
 	return req.Code >= 500
 }
 
+// CodeClass returns the class of the response status code ( 5 for 5xx )
+func (req *Request) CodeClass() int {
+	return req.Code / 100
+}
+
 // String representation in W3C Common Log Format
 // 127.0.0.1 - mary [09/May/2018:16:00:42 +0000] "POST /api/user HTTP/1.0" 503 12
 func (req *Request) String() string {
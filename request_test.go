@@ -57,6 +57,20 @@ func TestRequest_IsServerError(t *testing.T) {
 	require.True(t, req.IsServerError())
 }
 
+func TestRequest_CodeClass(t *testing.T) {
+	req := &Request{}
+	require.Equal(t, 0, req.CodeClass())
+
+	req = &Request{Code: 200}
+	require.Equal(t, 2, req.CodeClass())
+
+	req = &Request{Code: 404}
+	require.Equal(t, 4, req.CodeClass())
+
+	req = &Request{Code: 599}
+	require.Equal(t, 5, req.CodeClass())
+}
+
 func TestRequest_String(t *testing.T) {
 	req := &Request{}
 	require.Equal(t, "<nil> -  [01/Jan/0001:00:00:00 +0000] \"  \" 0 0", req.String())
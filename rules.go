@@ -0,0 +1,219 @@
+package accessmon
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Rule describes a named alerting rule
+type Rule struct {
+	Name      string        `yaml:"name"`
+	Metric    string        `yaml:"metric"`    // MetricRequestRate, MetricLatency or MetricErrorRate
+	Filter    *Filter       `yaml:"filter"`    // only the matching requests are taken into account
+	Window    time.Duration `yaml:"window"`    // sliding window size
+	Threshold float64       `yaml:"threshold"` // req/s, latency in seconds, error percentage or standard deviations
+	Severity  string        `yaml:"severity"`  // free form severity reported in the alerts
+
+	ClearWindow    time.Duration `yaml:"clear_window"`    // sliding window size to clear an alert ( Window by default )
+	ClearThreshold float64       `yaml:"clear_threshold"` // threshold to go under to clear an alert ( Threshold by default )
+
+	PerSection bool            `yaml:"per_section"` // run the alert state machine independently for each section
+	Baseline   *BaselineConfig `yaml:"baseline"`    // alert on deviations from a learned baseline instead of a fixed threshold
+
+	Percentile  float64 `yaml:"percentile"`   // latency percentile ( 95 by default )
+	Class       int     `yaml:"class"`        // error status code class ( 5 for 5xx by default )
+	MinRequests int     `yaml:"min_requests"` // minimum number of requests in the window for the error rate to trigger
+}
+
+// Filter selects the requests a Rule applies to
+// Empty fields match any request
+type Filter struct {
+	Section    string `yaml:"section"`
+	PathPrefix string `yaml:"path_prefix"`
+	Method     string `yaml:"method"`
+	User       string `yaml:"user"`
+	Source     string `yaml:"source"` // source IP or CIDR
+
+	network *net.IPNet // parsed Source
+}
+
+// rulesFile is the root of the rules configuration file
+type rulesFile struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// LoadRules reads and validates the alerting rules from a YAML file
+// rules:
+//   - name: api_traffic
+//     metric: request_rate
+//     filter: { section: /api }
+//     window: 2m
+//     threshold: 10
+//     clear_threshold: 8
+//     severity: warning
+func LoadRules(path string) (rules []*Rule, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &rulesFile{}
+	err = yaml.UnmarshalStrict(data, file)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, rule := range file.Rules {
+		rule.setDefaults()
+		err = rule.Validate()
+		if err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+
+	return file.Rules, nil
+}
+
+// setDefaults sets the parameters of the rule left to zero to their default
+func (rule *Rule) setDefaults() {
+	switch rule.Metric {
+	case MetricLatency:
+		if rule.Percentile == 0 {
+			rule.Percentile = latencyAlertPercentile
+		}
+	case MetricErrorRate:
+		if rule.Class == 0 {
+			rule.Class = 5
+		}
+	}
+}
+
+// Validate checks the rule parameters, zero values stand for the defaults
+func (rule *Rule) Validate() error {
+	if rule.Name == "" {
+		return errors.New("missing rule name")
+	}
+	if rule.Window <= 0 {
+		return fmt.Errorf("rule %q : window must be positive", rule.Name)
+	}
+	if rule.Threshold <= 0 {
+		return fmt.Errorf("rule %q : threshold must be positive", rule.Name)
+	}
+	if rule.ClearWindow < 0 {
+		return fmt.Errorf("rule %q : clear window must be positive", rule.Name)
+	}
+	if rule.ClearThreshold < 0 || rule.ClearThreshold > rule.Threshold {
+		return fmt.Errorf("rule %q : clear threshold must be positive and lower than threshold", rule.Name)
+	}
+
+	switch rule.Metric {
+	case MetricRequestRate:
+	case MetricLatency:
+		if rule.Percentile < 0 || rule.Percentile > 100 {
+			return fmt.Errorf("rule %q : invalid percentile", rule.Name)
+		}
+	case MetricErrorRate:
+		if rule.Class < 0 || rule.Class > 5 {
+			return fmt.Errorf("rule %q : invalid status code class", rule.Name)
+		}
+	default:
+		return fmt.Errorf("rule %q : unknown metric %q", rule.Name, rule.Metric)
+	}
+
+	if rule.Baseline != nil {
+		if rule.Baseline.Alpha < 0 || rule.Baseline.Alpha > 1 {
+			return fmt.Errorf("rule %q : baseline alpha must be between 0 and 1", rule.Name)
+		}
+		if rule.Baseline.Warmup < 0 {
+			return fmt.Errorf("rule %q : baseline warmup must be positive", rule.Name)
+		}
+	}
+
+	if rule.Filter != nil && rule.Filter.Source != "" {
+		if _, err := rule.Filter.source(); err != nil {
+			return fmt.Errorf("rule %q : invalid source filter", rule.Name)
+		}
+	}
+
+	return nil
+}
+
+// metric returns the function computing the watched value of the rule
+func (rule *Rule) metric() metric {
+	switch rule.Metric {
+	case MetricLatency:
+		return latencyPercentileMetric(rule.Percentile)
+	case MetricErrorRate:
+		return errorRateMetric(rule.Class, rule.MinRequests)
+	default:
+		return requestRate
+	}
+}
+
+// Match returns true if the request matches every non empty field of the filter
+func (filter *Filter) Match(req *Request) bool {
+	if filter.Section != "" && req.Section != filter.Section {
+		return false
+	}
+	if filter.PathPrefix != "" && !strings.HasPrefix(req.Path, filter.PathPrefix) {
+		return false
+	}
+	if filter.Method != "" && req.Method != filter.Method {
+		return false
+	}
+	if filter.User != "" && req.User != filter.User {
+		return false
+	}
+	if filter.Source != "" {
+		network := filter.network
+		if network == nil {
+			network, _ = filter.source()
+		}
+		if network == nil || !network.Contains(req.SourceIP) {
+			return false
+		}
+	}
+	return true
+}
+
+// source parses the source filter as a CIDR or a single IP
+func (filter *Filter) source() (*net.IPNet, error) {
+	if strings.Contains(filter.Source, "/") {
+		_, network, err := net.ParseCIDR(filter.Source)
+		return network, err
+	}
+	ip := net.ParseIP(filter.Source)
+	if ip == nil {
+		return nil, errors.New("invalid ip")
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// filterRequests returns the requests matching the filter
+// The provided slice is returned as is if there is no filter
+func filterRequests(requests []*Request, filter *Filter) []*Request {
+	if filter == nil {
+		return requests
+	}
+	var filtered []*Request
+	for _, req := range requests {
+		if filter.Match(req) {
+			filtered = append(filtered, req)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,137 @@
+package accessmon
+
+import (
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func writeRulesFile(t *testing.T, content string) string {
+	tmpfile, err := ioutil.TempFile("", "rules.yaml_")
+	require.NoError(t, err)
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+
+	err = tmpfile.Close()
+	require.NoError(t, err)
+
+	return tmpfile.Name()
+}
+
+func TestLoadRules(t *testing.T) {
+	path := writeRulesFile(t, `
+rules:
+  - name: api_traffic
+    metric: request_rate
+    filter:
+      section: /api
+      source: 10.0.0.0/8
+    window: 2m
+    threshold: 10
+    severity: warning
+  - name: slow
+    metric: latency
+    window: 30s
+    threshold: 0.5
+  - name: errors
+    metric: error_rate
+    window: 1m
+    threshold: 5
+    min_requests: 100
+    severity: critical
+`)
+	defer func() {
+		_ = os.Remove(path)
+	}()
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+
+	require.Equal(t, "api_traffic", rules[0].Name)
+	require.Equal(t, MetricRequestRate, rules[0].Metric)
+	require.Equal(t, "/api", rules[0].Filter.Section)
+	require.Equal(t, 2*time.Minute, rules[0].Window)
+	require.Equal(t, float64(10), rules[0].Threshold)
+	require.Equal(t, "warning", rules[0].Severity)
+
+	require.Equal(t, float64(95), rules[1].Percentile)
+	require.Nil(t, rules[1].Filter)
+
+	require.Equal(t, 5, rules[2].Class)
+	require.Equal(t, 100, rules[2].MinRequests)
+}
+
+func TestLoadRulesError(t *testing.T) {
+	_, err := LoadRules("invalid_file_name")
+	require.Error(t, err)
+
+	inputs := []string{
+		"rules: invalid",
+		"rules:\n  - name: a\n    metric: request_rate\n    window: 1m\n    threshold: 1\n    unknown: 1\n",
+		"rules:\n  - name: a\n    metric: request_rate\n    window: 1m\n    threshold: 1\n  - name: a\n    metric: request_rate\n    window: 1m\n    threshold: 1\n",
+		"rules:\n  - metric: request_rate\n    window: 1m\n    threshold: 1\n",
+		"rules:\n  - name: a\n    metric: invalid\n    window: 1m\n    threshold: 1\n",
+		"rules:\n  - name: a\n    metric: request_rate\n    threshold: 1\n",
+		"rules:\n  - name: a\n    metric: request_rate\n    window: 1m\n",
+		"rules:\n  - name: a\n    metric: latency\n    window: 1m\n    threshold: 1\n    percentile: 101\n",
+		"rules:\n  - name: a\n    metric: error_rate\n    window: 1m\n    threshold: 1\n    class: 6\n",
+		"rules:\n  - name: a\n    metric: request_rate\n    window: 1m\n    threshold: 1\n    filter: { source: invalid }\n",
+		"rules:\n  - name: a\n    metric: request_rate\n    window: 1m\n    threshold: 1\n    clear_threshold: 2\n",
+	}
+
+	for _, input := range inputs {
+		path := writeRulesFile(t, input)
+		_, err := LoadRules(path)
+		_ = os.Remove(path)
+		require.Error(t, err, input)
+	}
+}
+
+func TestRule_ValidateNoSideEffect(t *testing.T) {
+	rule := &Rule{Name: "internal", Metric: MetricErrorRate, Window: time.Minute, Threshold: 5, Filter: &Filter{Source: "10.0.0.0/8"}}
+	require.NoError(t, rule.Validate())
+	require.Nil(t, rule.Filter.network)
+	require.Equal(t, 0, rule.Class)
+
+	// The Detector parses the source filter into its own copy
+
+	detector, err := NewRuleDetector(rule)
+	require.NoError(t, err)
+	require.Nil(t, rule.Filter.network)
+	require.NotNil(t, detector.(*ruleDetector).rule.Filter.network)
+	require.Equal(t, 5, detector.(*ruleDetector).rule.Class)
+}
+
+func TestFilter_Match(t *testing.T) {
+	req := &Request{
+		SourceIP: net.ParseIP("10.0.0.1"),
+		User:     "mary",
+		Method:   "POST",
+		Path:     "/api/user",
+		Section:  "/api",
+	}
+
+	require.True(t, (&Filter{}).Match(req))
+	require.True(t, (&Filter{Section: "/api", PathPrefix: "/api/us", Method: "POST", User: "mary", Source: "10.0.0.0/8"}).Match(req))
+	require.True(t, (&Filter{Source: "10.0.0.1"}).Match(req))
+	require.False(t, (&Filter{Section: "/www"}).Match(req))
+	require.False(t, (&Filter{PathPrefix: "/www"}).Match(req))
+	require.False(t, (&Filter{Method: "GET"}).Match(req))
+	require.False(t, (&Filter{User: "bob"}).Match(req))
+	require.False(t, (&Filter{Source: "10.0.0.2"}).Match(req))
+	require.False(t, (&Filter{Source: "::1"}).Match(req))
+	require.False(t, (&Filter{Source: "invalid"}).Match(req))
+}
+
+func TestFilterRequests(t *testing.T) {
+	requests := []*Request{{Section: "/api"}, {Section: "/www"}, {Section: "/api"}}
+
+	require.Len(t, filterRequests(requests, nil), 3)
+	require.Len(t, filterRequests(requests, &Filter{Section: "/api"}), 2)
+	require.Len(t, filterRequests(requests, &Filter{Section: "/static"}), 0)
+}
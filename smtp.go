@@ -0,0 +1,208 @@
+package accessmon
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds the parameters of an SMTPNotifier
+type SMTPConfig struct {
+	Addr      string        // SMTP server address host:port
+	From      string        // Sender address
+	To        []string      // Recipient addresses
+	Username  string        // PLAIN authentication username, no authentication if empty
+	Password  string        // PLAIN authentication password
+	StartTLS  bool          // Require STARTTLS before authenticating and sending
+	TLSConfig *tls.Config   // STARTTLS configuration ( server name from Addr by default )
+	Batch     time.Duration // Alert transitions within the interval are sent in a single message ( 30s by default )
+	Timeout   time.Duration // Connection timeout ( 10s by default )
+	QueueSize int           // Maximum number of pending events, new events are dropped when full ( 100 by default )
+	Logger    *log.Logger   // Logger for the failed deliveries ( standard logger by default )
+}
+
+// Default SMTPConfig parameters
+const (
+	defaultSMTPBatch     = 30 * time.Second
+	defaultSMTPTimeout   = 10 * time.Second
+	defaultSMTPQueueSize = 100
+)
+
+// SMTPNotifier emails the alert transitions through an SMTP server
+// Transitions happening within the batch interval are grouped in a single message
+type SMTPNotifier struct {
+	*asyncNotifier
+
+	config *SMTPConfig
+}
+
+// NewSMTPNotifier builds an SMTPNotifier and starts its background goroutine
+func NewSMTPNotifier(config *SMTPConfig) (notifier *SMTPNotifier, err error) {
+	if config.Addr == "" {
+		return nil, errors.New("missing smtp server address")
+	}
+	if config.From == "" {
+		return nil, errors.New("missing smtp sender address")
+	}
+	if len(config.To) == 0 {
+		return nil, errors.New("missing smtp recipient address")
+	}
+	if config.Batch <= 0 {
+		config.Batch = defaultSMTPBatch
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultSMTPTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultSMTPQueueSize
+	}
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	notifier = &SMTPNotifier{config: config}
+	notifier.asyncNotifier = newAsyncNotifier(config.QueueSize, config.Batch, notifier.send)
+
+	return notifier, nil
+}
+
+// send emails the events and logs the failures
+func (notifier *SMTPNotifier) send(events []*AlertEvent) {
+	err := notifier.deliver(notifier.message(events))
+	if err != nil {
+		notifier.config.Logger.Printf("alert email to %s : %s", strings.Join(notifier.config.To, ","), err)
+	}
+}
+
+// deliver runs the SMTP transaction
+func (notifier *SMTPNotifier) deliver(message []byte) (err error) {
+	host, _, err := net.SplitHostPort(notifier.config.Addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", notifier.config.Addr, notifier.config.Timeout)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(notifier.config.Timeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if notifier.config.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		config := notifier.config.TLSConfig
+		if config == nil {
+			config = &tls.Config{ServerName: host}
+		}
+		err = client.StartTLS(config)
+		if err != nil {
+			return err
+		}
+	}
+
+	if notifier.config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", notifier.config.Username, notifier.config.Password, host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(notifier.config.From)
+	if err != nil {
+		return err
+	}
+	for _, to := range notifier.config.To {
+		err = client.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(message)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// message builds the email for the events
+func (notifier *SMTPNotifier) message(events []*AlertEvent) []byte {
+	var opened, resolved int
+	for _, event := range events {
+		if event.Status == AlertStatusOpen {
+			opened++
+		} else {
+			resolved++
+		}
+	}
+
+	var subject string
+	if len(events) == 1 {
+		event := events[0]
+		status := "opened"
+		if event.Status == AlertStatusClosed {
+			status = "resolved"
+		}
+		subject = fmt.Sprintf("[accessmon] %s alert %s on %s", alertEventName(event), status, event.Host)
+	} else {
+		subject = fmt.Sprintf("[accessmon] %d alerts opened, %d resolved on %s", opened, resolved, events[0].Host)
+	}
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "From: %s\r\n", notifier.config.From)
+	fmt.Fprintf(&buffer, "To: %s\r\n", strings.Join(notifier.config.To, ", "))
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buffer, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buffer, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&buffer, "\r\n")
+
+	for _, event := range events {
+		if event.Status == AlertStatusOpen {
+			fmt.Fprintf(&buffer, "OPEN     %s : %s value %g since %s\r\n", alertEventName(event), event.Metric, event.Value, event.Start.Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(&buffer, "RESOLVED %s : %s value %g from %s to %s ( %s )\r\n", alertEventName(event), event.Metric, event.Value,
+				event.Start.Format(time.RFC3339), event.End.Format(time.RFC3339), event.End.Sub(event.Start))
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+// alertEventName returns the rule name with the severity and the section if any
+// Line breaks are stripped from the section which comes from the logs
+func alertEventName(event *AlertEvent) (name string) {
+	name = event.Rule
+	if event.Section != "" {
+		name += " " + strings.NewReplacer("\r", "", "\n", "").Replace(event.Section)
+	}
+	if event.Severity != "" {
+		name += " [" + event.Severity + "]"
+	}
+	return name
+}
@@ -0,0 +1,240 @@
+package accessmon
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"log"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// smtpMessage is a message received by the smtpServer
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+	auth string
+}
+
+// smtpServer is a minimal in-process SMTP server
+type smtpServer struct {
+	listener net.Listener
+	tls      *tls.Config // STARTTLS is advertised if set
+
+	lock     sync.Mutex
+	messages []*smtpMessage
+}
+
+func newSMTPServer(t *testing.T, tlsConfig *tls.Config) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &smtpServer{listener: listener, tls: tlsConfig}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *smtpServer) Addr() string {
+	return server.listener.Addr().String()
+}
+
+func (server *smtpServer) Close() {
+	_ = server.listener.Close()
+}
+
+func (server *smtpServer) Messages() []*smtpMessage {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.messages
+}
+
+func (server *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	message := &smtpMessage{}
+	_ = text.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			if server.tls != nil && !message.tls {
+				_ = text.PrintfLine("250-localhost\r\n250-STARTTLS\r\n250 AUTH PLAIN")
+			} else {
+				_ = text.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			_ = text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, server.tls)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			message.tls = true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			message.auth = string(credentials)
+			_ = text.PrintfLine("235 ok")
+		case "MAIL":
+			message.from = strings.TrimPrefix(line, "MAIL FROM:")
+			_ = text.PrintfLine("250 ok")
+		case "RCPT":
+			message.to = append(message.to, strings.TrimPrefix(line, "RCPT TO:"))
+			_ = text.PrintfLine("250 ok")
+		case "DATA":
+			_ = text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			server.lock.Lock()
+			server.messages = append(server.messages, message)
+			server.lock.Unlock()
+			_ = text.PrintfLine("250 ok")
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier_Batch(t *testing.T) {
+	server := newSMTPServer(t, nil)
+	defer server.Close()
+
+	notifier, err := NewSMTPNotifier(&SMTPConfig{
+		Addr:     server.Addr(),
+		From:     "accessmon@example.com",
+		To:       []string{"ops@example.com", "dev@example.com"},
+		Username: "mary",
+		Password: "secret",
+		Batch:    200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	// Both transitions are received within the batch interval
+
+	alert := &Alert{Rule: "high_traffic", Severity: "critical", Metric: MetricRequestRate, Start: start, Value: 12.5}
+	notifier.Notify(alert)
+	notifier.Notify(&Alert{Rule: "high_latency", Metric: MetricLatency, Start: start.Add(-time.Minute), End: start, Value: 0.5})
+	time.Sleep(500 * time.Millisecond)
+
+	alert.End = start.Add(time.Minute)
+	notifier.Notify(alert)
+	notifier.Close()
+
+	messages := server.Messages()
+	require.Len(t, messages, 2)
+
+	require.Equal(t, "<accessmon@example.com>", messages[0].from)
+	require.Equal(t, []string{"<ops@example.com>", "<dev@example.com>"}, messages[0].to)
+	require.Equal(t, "\x00mary\x00secret", messages[0].auth)
+	require.Contains(t, messages[0].data, "Subject: [accessmon] 1 alerts opened, 1 resolved on ")
+	require.Contains(t, messages[0].data, "OPEN     high_traffic [critical] : request_rate value 12.5 since 2019-05-03T00:00:00Z")
+	require.Contains(t, messages[0].data, "RESOLVED high_latency : latency value 0.5 from 2019-05-02T23:59:00Z to 2019-05-03T00:00:00Z ( 1m0s )")
+
+	require.Contains(t, messages[1].data, "Subject: [accessmon] high_traffic [critical] alert resolved on ")
+}
+
+func TestSMTPNotifier_StartTLS(t *testing.T) {
+	https := httptest.NewTLSServer(nil)
+	certificate := https.TLS.Certificates[0]
+	https.Close()
+
+	server := newSMTPServer(t, &tls.Config{Certificates: []tls.Certificate{certificate}})
+	defer server.Close()
+
+	notifier, err := NewSMTPNotifier(&SMTPConfig{
+		Addr:      server.Addr(),
+		From:      "accessmon@example.com",
+		To:        []string{"ops@example.com"},
+		StartTLS:  true,
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+		Batch:     time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	notifier.Notify(&Alert{Rule: "high_traffic", Metric: MetricRequestRate, Start: start, Value: 12.5})
+	notifier.Close()
+
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	require.True(t, messages[0].tls)
+	require.Contains(t, messages[0].data, "Subject: [accessmon] high_traffic alert opened on ")
+}
+
+func TestSMTPNotifier_MessageSubject(t *testing.T) {
+	notifier := &SMTPNotifier{config: &SMTPConfig{From: "accessmon@example.com", To: []string{"ops@example.com"}}}
+
+	// Line breaks from the logs must not inject headers
+
+	event := &AlertEvent{Rule: "section_traffic", Section: "/api\r\nBcc: evil@example.com", Status: AlertStatusOpen, Start: start, Host: "www1"}
+	message := string(notifier.message([]*AlertEvent{event}))
+	require.Contains(t, message, "Subject: [accessmon] section_traffic /apiBcc: evil@example.com alert opened on www1\r\n")
+	require.NotContains(t, message, "\r\nBcc:")
+
+	// Non ASCII subjects are encoded
+
+	event = &AlertEvent{Rule: "section_traffic", Section: "/café", Status: AlertStatusOpen, Start: start, Host: "www1"}
+	message = string(notifier.message([]*AlertEvent{event}))
+	require.Contains(t, message, "Subject: =?utf-8?q?[accessmon]_section=5Ftraffic_/caf=C3=A9_alert_opened_on_www1?=\r\n")
+}
+
+func TestSMTPNotifier_Error(t *testing.T) {
+	_, err := NewSMTPNotifier(&SMTPConfig{From: "accessmon@example.com", To: []string{"ops@example.com"}})
+	require.Error(t, err)
+
+	_, err = NewSMTPNotifier(&SMTPConfig{Addr: "127.0.0.1:25", To: []string{"ops@example.com"}})
+	require.Error(t, err)
+
+	_, err = NewSMTPNotifier(&SMTPConfig{Addr: "127.0.0.1:25", From: "accessmon@example.com"})
+	require.Error(t, err)
+
+	// STARTTLS is required but not supported by the server
+
+	server := newSMTPServer(t, nil)
+	defer server.Close()
+
+	var output bytes.Buffer
+	notifier, err := NewSMTPNotifier(&SMTPConfig{
+		Addr:     server.Addr(),
+		From:     "accessmon@example.com",
+		To:       []string{"ops@example.com"},
+		StartTLS: true,
+		Batch:    time.Millisecond,
+		Logger:   log.New(&output, "", 0),
+	})
+	require.NoError(t, err)
+
+	notifier.Notify(&Alert{Rule: "high_traffic", Start: start})
+	notifier.Close()
+
+	require.Len(t, server.Messages(), 0)
+	require.Contains(t, output.String(), "smtp server does not support STARTTLS")
+}
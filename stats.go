@@ -1,7 +1,9 @@
 package accessmon
 
 import (
+	"math"
 	"sort"
+	"time"
 )
 
 // Stats summarize somme statistics about a bunch of Requests
@@ -11,22 +13,44 @@ type Stats struct {
 	HTTP2       float64 // percentage of HTTP2 requests
 	ServerError float64 // percentage of Server Error response
 
+	StatusClasses map[int]int // number of requests by response status code class ( 5 for 5xx )
+
+	Latency *Latency // response time distribution ( nil if the log format provides no duration )
+
 	TopUsers   []*CounterValue // top N users
 	TopSection []*CounterValue // top N sections
 	TopSources []*CounterValue // top N source IPs
+
+	SectionLatency map[string]*Latency // response time distribution of the top N sections
+}
+
+// Latency summarizes the response time distribution of a bunch of Requests
+type Latency struct {
+	Count int           // number of requests with a known duration
+	P50   time.Duration // median
+	P90   time.Duration // 90th percentile
+	P99   time.Duration // 99th percentile
+	Max   time.Duration // slowest request
 }
 
 // NewStats computes statistics about the provided requests
 func NewStats(requests []*Request, top int) (s *Stats) {
-	s = &Stats{}
+	s = &Stats{StatusClasses: make(map[int]int)}
 
 	totalReq := 0
 	totalIPv6 := 0
 	totalHTTP2 := 0
 	totalServerError := 0
 
+	var durations []time.Duration
+
 	for _, req := range requests {
 		totalReq++
+		s.StatusClasses[req.CodeClass()]++
+
+		if req.HasDuration {
+			durations = append(durations, req.Duration)
+		}
 
 		if req.IsIPv6() {
 			totalIPv6++
@@ -45,6 +69,7 @@ func NewStats(requests []*Request, top int) (s *Stats) {
 	s.Ipv6 = (float64(totalIPv6) / float64(totalReq)) * 100
 	s.HTTP2 = (float64(totalHTTP2) / float64(totalReq)) * 100
 	s.ServerError = (float64(totalServerError) / float64(totalReq)) * 100
+	s.Latency = newLatency(durations)
 
 	if top > 0 {
 		sourceCount := newCounter()
@@ -60,11 +85,56 @@ func NewStats(requests []*Request, top int) (s *Stats) {
 		s.TopSources = sourceCount.top(top)
 		s.TopUsers = userCount.top(top)
 		s.TopSection = sectionCount.top(top)
+
+		sectionDurations := make(map[string][]time.Duration)
+		for _, section := range s.TopSection {
+			sectionDurations[section.Key] = nil
+		}
+		for _, req := range requests {
+			if _, ok := sectionDurations[req.Section]; ok && req.HasDuration {
+				sectionDurations[req.Section] = append(sectionDurations[req.Section], req.Duration)
+			}
+		}
+
+		s.SectionLatency = make(map[string]*Latency)
+		for section, durations := range sectionDurations {
+			if latency := newLatency(durations); latency != nil {
+				s.SectionLatency[section] = latency
+			}
+		}
 	}
 
 	return s
 }
 
+// newLatency computes the distribution of the provided durations
+// It returns nil if there is no duration
+// /!\ durations are sorted in place /!\
+func newLatency(durations []time.Duration) (l *Latency) {
+	if len(durations) == 0 {
+		return nil
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	return &Latency{
+		Count: len(durations),
+		P50:   percentile(durations, 50),
+		P90:   percentile(durations, 90),
+		P99:   percentile(durations, 99),
+		Max:   durations[len(durations)-1],
+	}
+}
+
+// percentile returns the nearest rank percentile of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
 // counter holds the key distribution count
 type counter struct {
 	counts map[string]int
@@ -87,7 +157,7 @@ func (c *counter) top(n int) []*CounterValue {
 	for key, value := range c.counts {
 		top = append(top, &CounterValue{Key: key, Count: value})
 	}
-	sort.Sort(CounterList(top))
+	sort.SliceStable(top, CounterList(top).Less)
 	if len(top) <= n {
 		return top
 	}
@@ -103,6 +173,14 @@ type CounterValue struct {
 // CounterList is an interface to sort CounterValues
 type CounterList []*CounterValue
 
-func (h CounterList) Len() int           { return len(h) }
-func (h CounterList) Less(i, j int) bool { return h[i].Count < h[j].Count }
-func (h CounterList) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h CounterList) Len() int      { return len(h) }
+func (h CounterList) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+// Less sorts by descending count, the equal counts are sorted by key
+// so that the order does not depend on the map iteration
+func (h CounterList) Less(i, j int) bool {
+	if h[i].Count != h[j].Count {
+		return h[i].Count > h[j].Count
+	}
+	return h[i].Key < h[j].Key
+}
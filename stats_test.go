@@ -6,6 +6,7 @@ import (
 	"net"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestNewStatsCount(t *testing.T) {
@@ -62,6 +63,7 @@ func TestNewStatsPercentages(t *testing.T) {
 	assert.Equal(t, float64(10), stats.Ipv6)
 	assert.Equal(t, float64(10), stats.HTTP2)
 	assert.Equal(t, float64(10), stats.ServerError)
+	assert.Equal(t, map[int]int{2: 900, 5: 100}, stats.StatusClasses)
 
 }
 
@@ -117,9 +119,9 @@ func TestNewStatsTop(t *testing.T) {
 	alter(3, 200, 400)  // 200
 	alter(4, 400, 1000) // 600
 
-	counts := []int{10, 90, 100, 200, 600}
+	counts := []int{600, 200, 100, 90, 10}
 	check := func(stats *Stats, i int) {
-		index := strconv.Itoa(i)
+		index := strconv.Itoa(len(counts) - 1 - i)
 		section := "section_" + index
 		user := "user_" + index
 		ip := net.ParseIP("127.0.0." + index)
@@ -145,4 +147,65 @@ func TestNewStatsTop(t *testing.T) {
 	for i := range counts {
 		check(stats, i)
 	}
+
+	stats = NewStats(requests, 2)
+	require.Equal(t, "section_4", stats.TopSection[0].Key)
+	require.Equal(t, "section_3", stats.TopSection[1].Key)
+}
+
+func TestNewStatsTopTie(t *testing.T) {
+	var requests []*Request
+	for _, section := range []string{"/c", "/a", "/d", "/b", "/a"} {
+		requests = append(requests, &Request{SourceIP: net.ParseIP("127.0.0.1"), Section: section})
+	}
+
+	// Equal counts are sorted by key
+
+	for i := 0; i < 10; i++ {
+		stats := NewStats(requests, 3)
+		require.Equal(t, "/a", stats.TopSection[0].Key)
+		require.Equal(t, "/b", stats.TopSection[1].Key)
+		require.Equal(t, "/c", stats.TopSection[2].Key)
+	}
+}
+
+func TestNewStatsLatency(t *testing.T) {
+
+	requests := make([]*Request, 200)
+	for i := range requests {
+		r := &Request{
+			SourceIP: net.ParseIP("127.0.0.1"),
+			User:     "user",
+			Section:  "/api",
+			Code:     200,
+		}
+		if i >= 100 {
+			r.Section = "/www"
+			r.Duration = time.Duration(i-99) * time.Millisecond
+			r.HasDuration = true
+		}
+		requests[i] = r
+	}
+
+	stats := NewStats(requests[:100], 1)
+	assert.Nil(t, stats.Latency)
+	assert.Len(t, stats.SectionLatency, 0)
+
+	stats = NewStats(requests, 2)
+	require.NotNil(t, stats.Latency)
+	assert.Equal(t, 100, stats.Latency.Count)
+	assert.Equal(t, 50*time.Millisecond, stats.Latency.P50)
+	assert.Equal(t, 90*time.Millisecond, stats.Latency.P90)
+	assert.Equal(t, 99*time.Millisecond, stats.Latency.P99)
+	assert.Equal(t, 100*time.Millisecond, stats.Latency.Max)
+
+	assert.Len(t, stats.SectionLatency, 1)
+	require.NotNil(t, stats.SectionLatency["/www"])
+	assert.Equal(t, 100*time.Millisecond, stats.SectionLatency["/www"].Max)
+
+	stats = NewStats(requests[190:], 1)
+	require.NotNil(t, stats.Latency)
+	assert.Equal(t, 10, stats.Latency.Count)
+	assert.Equal(t, 95*time.Millisecond, stats.Latency.P50)
+	assert.Equal(t, 100*time.Millisecond, stats.Latency.P99)
 }
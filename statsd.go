@@ -0,0 +1,133 @@
+package accessmon
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// StatsDConfig holds the parameters of a StatsDPusher
+type StatsDConfig struct {
+	Addr      string   // StatsD server UDP address host:port
+	Prefix    string   // Metric name prefix ( accessmon by default )
+	Tags      []string // DogStatsD tags added to every metric ( key:value )
+	DogStatsD bool     // Use DogStatsD tags, otherwise the section is part of the metric name
+}
+
+// statsdPacketSize is the maximum payload size of a datagram, small enough to avoid IP fragmentation
+const statsdPacketSize = 1432
+
+// StatsDPusher pushes counters and gauges derived from the Stats over UDP
+// in the StatsD line protocol, optionally with DogStatsD tags
+// see : https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+type StatsDPusher struct {
+	config *StatsDConfig
+	conn   net.Conn
+}
+
+// NewStatsDPusher builds a StatsDPusher sending to the configured address
+func NewStatsDPusher(config *StatsDConfig) (pusher *StatsDPusher, err error) {
+	if config.Prefix == "" {
+		config.Prefix = "accessmon"
+	}
+
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsDPusher{config: config, conn: conn}, nil
+}
+
+// Push sends the stats as StatsD metrics : the requests counter, the request rate, the server error, HTTP2
+// and IPv6 percentage gauges and the latency percentile gauges in milliseconds. The requests counter and
+// the latency gauges are also sent for each top section
+func (pusher *StatsDPusher) Push(stats *Stats, now time.Time, window time.Duration) (err error) {
+	lines := []string{
+		pusher.line("requests", stats.Count, "c", ""),
+		pusher.line("request_rate", perSecond(stats.Count, window), "g", ""),
+	}
+	if stats.Count > 0 {
+		lines = append(lines,
+			pusher.line("server_error_percent", stats.ServerError, "g", ""),
+			pusher.line("http2_percent", stats.HTTP2, "g", ""),
+			pusher.line("ipv6_percent", stats.Ipv6, "g", ""),
+		)
+	}
+	lines = append(lines, pusher.latency(stats.Latency, "")...)
+
+	for _, section := range stats.TopSection {
+		lines = append(lines, pusher.line("section.requests", section.Count, "c", section.Key))
+		lines = append(lines, pusher.latency(stats.SectionLatency[section.Key], section.Key)...)
+	}
+
+	return pusher.send(lines)
+}
+
+// Close closes the UDP socket
+func (pusher *StatsDPusher) Close() error {
+	return pusher.conn.Close()
+}
+
+// latency formats the latency gauges, if any
+func (pusher *StatsDPusher) latency(latency *Latency, section string) (lines []string) {
+	if latency == nil {
+		return nil
+	}
+	prefix := "latency."
+	if section != "" {
+		prefix = "section.latency."
+	}
+	return []string{
+		pusher.line(prefix+"p50", milliseconds(latency.P50), "g", section),
+		pusher.line(prefix+"p90", milliseconds(latency.P90), "g", section),
+		pusher.line(prefix+"p99", milliseconds(latency.P99), "g", section),
+		pusher.line(prefix+"max", milliseconds(latency.Max), "g", section),
+	}
+}
+
+// tagInvalidChars replaces the DogStatsD separators in the tag values
+var tagInvalidChars = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// line formats a metric, the section is a tag or a part of the metric name
+func (pusher *StatsDPusher) line(name string, value interface{}, kind string, section string) string {
+	tags := pusher.config.Tags
+	if section != "" {
+		if pusher.config.DogStatsD {
+			tags = append(tags[:len(tags):len(tags)], "section:"+tagInvalidChars.Replace(section))
+		} else {
+			parts := strings.SplitN(name, ".", 2)
+			name = parts[0] + "." + sectionName(section) + "." + parts[1]
+		}
+	}
+
+	line := fmt.Sprintf("%s.%s:%v|%s", pusher.config.Prefix, name, value, kind)
+	if pusher.config.DogStatsD && len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// send packs the lines in as few datagrams as possible
+func (pusher *StatsDPusher) send(lines []string) (err error) {
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdPacketSize {
+			_, err = pusher.conn.Write(packet.Bytes())
+			if err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		_, err = pusher.conn.Write(packet.Bytes())
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package accessmon
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func listenUDP(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	return conn
+}
+
+func readUDP(t *testing.T, conn *net.UDPConn) (lines []string) {
+	buffer := make([]byte, 65536)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return lines
+		}
+		lines = append(lines, strings.Split(string(buffer[:n]), "\n")...)
+	}
+}
+
+func testStats() *Stats {
+	return &Stats{
+		Count:       20,
+		Ipv6:        10,
+		HTTP2:       50,
+		ServerError: 5,
+		Latency:     &Latency{Count: 20, P50: 10 * time.Millisecond, P90: 50 * time.Millisecond, P99: 100 * time.Millisecond, Max: 1500 * time.Microsecond},
+		TopSection:  []*CounterValue{{Key: "/api", Count: 15}, {Key: "/", Count: 5}},
+		SectionLatency: map[string]*Latency{
+			"/api": {Count: 15, P50: 10 * time.Millisecond, P90: 50 * time.Millisecond, P99: 100 * time.Millisecond, Max: 200 * time.Millisecond},
+		},
+	}
+}
+
+func TestStatsDPusher_Push(t *testing.T) {
+	server := listenUDP(t)
+	defer server.Close()
+
+	pusher, err := NewStatsDPusher(&StatsDConfig{Addr: server.LocalAddr().String(), Tags: []string{"env:test"}, DogStatsD: true})
+	require.NoError(t, err)
+	defer pusher.Close()
+
+	require.NoError(t, pusher.Push(testStats(), start, 10*time.Second))
+
+	lines := readUDP(t, server)
+	require.Contains(t, lines, "accessmon.requests:20|c|#env:test")
+	require.Contains(t, lines, "accessmon.request_rate:2|g|#env:test")
+	require.Contains(t, lines, "accessmon.server_error_percent:5|g|#env:test")
+	require.Contains(t, lines, "accessmon.latency.max:1.5|g|#env:test")
+	require.Contains(t, lines, "accessmon.section.requests:15|c|#env:test,section:/api")
+	require.Contains(t, lines, "accessmon.section.latency.p99:100|g|#env:test,section:/api")
+	require.Contains(t, lines, "accessmon.section.requests:5|c|#env:test,section:/")
+	require.Len(t, lines, 15)
+}
+
+func TestStatsDPusher_PushTagSeparators(t *testing.T) {
+	server := listenUDP(t)
+	defer server.Close()
+
+	pusher, err := NewStatsDPusher(&StatsDConfig{Addr: server.LocalAddr().String(), DogStatsD: true})
+	require.NoError(t, err)
+	defer pusher.Close()
+
+	require.NoError(t, pusher.Push(&Stats{TopSection: []*CounterValue{{Key: "/a,b|c#d", Count: 1}}}, start, 10*time.Second))
+
+	lines := readUDP(t, server)
+	require.Contains(t, lines, "accessmon.section.requests:1|c|#section:/a_b_c_d")
+}
+
+func TestStatsDPusher_PushPlain(t *testing.T) {
+	server := listenUDP(t)
+	defer server.Close()
+
+	pusher, err := NewStatsDPusher(&StatsDConfig{Addr: server.LocalAddr().String(), Prefix: "www", Tags: []string{"env:test"}})
+	require.NoError(t, err)
+	defer pusher.Close()
+
+	require.NoError(t, pusher.Push(&Stats{TopSection: []*CounterValue{{Key: "/api", Count: 0}, {Key: "/", Count: 0}}}, start, 10*time.Second))
+
+	lines := readUDP(t, server)
+	require.Equal(t, []string{"www.requests:0|c", "www.request_rate:0|g", "www.section.api.requests:0|c", "www.section.root.requests:0|c"}, lines)
+}
+
+func TestStatsDPusher_Packets(t *testing.T) {
+	server := listenUDP(t)
+	defer server.Close()
+
+	pusher, err := NewStatsDPusher(&StatsDConfig{Addr: server.LocalAddr().String(), DogStatsD: true})
+	require.NoError(t, err)
+	defer pusher.Close()
+
+	stats := &Stats{Count: 1000}
+	for i := 0; i < 100; i++ {
+		stats.TopSection = append(stats.TopSection, &CounterValue{Key: "/section" + strings.Repeat("x", i), Count: 10})
+	}
+	require.NoError(t, pusher.Push(stats, start, 10*time.Second))
+
+	lines := readUDP(t, server)
+	require.Len(t, lines, 105)
+}
@@ -2,17 +2,22 @@ package accessmon
 
 import (
 	"errors"
+	"sync"
 	"time"
 )
 
 // Store accumulates requests
-// /!\ NOT THEAD SAFE /!\
+// It is safe for concurrent use
 type Store struct {
+	lock     sync.RWMutex
 	requests []*Request
 }
 
 // AddRequest adds a request to the store
 func (s *Store) AddRequest(req *Request) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
 	// We assume and ensure that time is continuously increasing in the log stream
 	if len(s.requests) > 0 {
 		last := s.requests[len(s.requests)-1]
@@ -26,19 +31,40 @@ func (s *Store) AddRequest(req *Request) (err error) {
 	return nil
 }
 
-// Since retrieve the requests that are newer than the provided deadline
+// Since retrieve a copy of the requests that are newer than the provided deadline
+// The slice is copied as Clean releases the references of the underlying array
 func (s *Store) Since(deadline time.Time) (requests []*Request) {
-	for i := len(s.requests) - 1; i >= 0; i-- {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]*Request(nil), s.requests[s.index(deadline):]...)
+}
+
+// since retrieve the requests that are newer than the provided deadline without copying them
+// The slice is only valid until the next call to Clean, it is meant for the writer of the Store
+func (s *Store) since(deadline time.Time) (requests []*Request) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.requests[s.index(deadline):len(s.requests):len(s.requests)]
+}
+
+// index returns the index of the first request newer than the provided deadline
+func (s *Store) index(deadline time.Time) int {
+	i := len(s.requests) - 1
+	for ; i >= 0; i-- {
 		if s.requests[i].Time.Before(deadline) || s.requests[i].Time.Equal(deadline) {
-			return s.requests[i+1:]
+			break
 		}
 	}
-
-	return s.requests
+	return i + 1
 }
 
 // Clean remove the requests that are older than the provided deadline
 func (s *Store) Clean(deadline time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
 	for len(s.requests) > 0 {
 		if s.requests[0].Time.Before(deadline) || s.requests[0].Time.Equal(deadline) {
 			// NOTE If the type of the slice element is a pointer or a struct with pointer fields
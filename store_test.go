@@ -1,9 +1,11 @@
 package accessmon
 
 import (
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -63,6 +65,27 @@ func TestStore_GetRequests(t *testing.T) {
 	require.Len(t, reqs, 120)
 }
 
+func TestStore_SinceCopy(t *testing.T) {
+	p := &Store{}
+	now := time.Date(2019, time.May, 3, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, p.AddRequest(&Request{Time: now.Add(time.Duration(i) * time.Second)}))
+	}
+	now = now.Add(9 * time.Second)
+
+	// The internal window shares the store array, the exported one is a copy
+
+	window := p.since(Deadline(now, 5*time.Second))
+	reqs := p.Since(Deadline(now, 5*time.Second))
+	require.Len(t, window, 5)
+	require.Equal(t, window, reqs)
+	require.Equal(t, len(window), cap(window))
+
+	p.Clean(Deadline(now, 2*time.Second))
+	require.Nil(t, window[0])
+	require.NotNil(t, reqs[0])
+}
+
 func TestStore_Clean(t *testing.T) {
 	var err error
 
@@ -87,3 +110,28 @@ func TestStore_Clean(t *testing.T) {
 
 	require.Equal(t, 20, len(p.Since(Deadline(now, time.Minute))))
 }
+
+func TestStore_Concurrent(t *testing.T) {
+	p := &Store{}
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				assert.NoError(t, p.AddRequest(&Request{Time: now}))
+				p.Clean(now.Add(-time.Second))
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		for _, req := range p.Since(now.Add(-time.Second)) {
+			require.NotNil(t, req)
+		}
+	}
+	wg.Wait()
+
+	require.Len(t, p.Since(now.Add(-time.Second)), 4000)
+}
@@ -0,0 +1,153 @@
+package accessmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stream pushes the Stats of each refresh interval and the alert transitions
+// to the connected clients as Server-Sent Events. It must be registered as a Notifier
+// and its StatsPusher must be given the stats of each refresh interval
+// see : https://html.spec.whatwg.org/multipage/server-sent-events.html
+// event: stats
+// data: {"time":"2019-05-03T00:00:00Z","window":10,"count":20,...}
+//
+// event: alert
+// data: {"rule":"high_traffic","status":"open",...}
+type Stream struct {
+	dropped int64 // events not sent to slow clients ( first for 64-bit atomic alignment )
+
+	lock    sync.Mutex
+	clients map[chan *streamEvent]struct{}
+	closed  bool
+	host    string
+}
+
+// streamClientQueueSize is the number of events buffered for each client
+const streamClientQueueSize = 16
+
+type streamEvent struct {
+	name string
+	data []byte
+}
+
+// NewStream builds a Stream without clients
+func NewStream() *Stream {
+	return &Stream{clients: make(map[chan *streamEvent]struct{}), host: hostname()}
+}
+
+// Push sends the stats to the clients
+func (stream *Stream) Push(stats *Stats, now time.Time, window time.Duration) error {
+	return stream.broadcast("stats", NewStatsResponse(stats, now, window))
+}
+
+// Notify sends the alert transition to the clients
+func (stream *Stream) Notify(alert *Alert) {
+	_ = stream.broadcast("alert", NewAlertEvent(alert, stream.host))
+}
+
+// Close disconnects the clients
+func (stream *Stream) Close() {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	if stream.closed {
+		return
+	}
+	stream.closed = true
+	for client := range stream.clients {
+		close(client)
+		delete(stream.clients, client)
+	}
+}
+
+// StatsPusher returns the Stream as a StatsPusher, the Stream is closed as a Notifier
+func (stream *Stream) StatsPusher() StatsPusher {
+	return streamPusher{stream}
+}
+
+type streamPusher struct {
+	*Stream
+}
+
+func (pusher streamPusher) Close() error {
+	return nil
+}
+
+// Dropped returns the number of events not sent to clients that were too slow to read them
+func (stream *Stream) Dropped() int64 {
+	return atomic.LoadInt64(&stream.dropped)
+}
+
+// broadcast queues the event for each client without blocking
+func (stream *Stream) broadcast(name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	event := &streamEvent{name: name, data: data}
+
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	for client := range stream.clients {
+		select {
+		case client <- event:
+		default:
+			atomic.AddInt64(&stream.dropped, 1)
+		}
+	}
+	return nil
+}
+
+// ServeHTTP streams the events until the client disconnects or the Stream is closed
+func (stream *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	// Register the client before sending the headers so that
+	// no event is missed once the response has been received
+
+	client := make(chan *streamEvent, streamClientQueueSize)
+	stream.lock.Lock()
+	if stream.closed {
+		stream.lock.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "stream closed")
+		return
+	}
+	stream.clients[client] = struct{}{}
+	stream.lock.Unlock()
+
+	defer func() {
+		stream.lock.Lock()
+		defer stream.lock.Unlock()
+		delete(stream.clients, client)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-client:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, event.data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
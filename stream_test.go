@@ -0,0 +1,102 @@
+package accessmon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readEvent reads the next Server-Sent Event
+func readEvent(t *testing.T, reader *bufio.Reader) (name string, data string) {
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	stream := NewStream()
+	mon, err := NewMonitor(&Config{StoreWindow: time.Minute, AlertWindow: time.Second, AlertThreshold: 1, Notifiers: []Notifier{stream}})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(stream)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+
+	// Alert transitions are sent as they happen
+
+	for i := 0; i < 3; i++ {
+		req := &Request{SourceIP: net.ParseIP("127.0.0.1"), User: "mary", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: "/api/user", HTTPVersion: "HTTP/1.1", Code: 200}
+		_, err := mon.AddLine(req.String())
+		require.NoError(t, err)
+	}
+
+	name, data := readEvent(t, reader)
+	require.Equal(t, "alert", name)
+	event := &AlertEvent{}
+	require.NoError(t, json.Unmarshal([]byte(data), event))
+	require.Equal(t, "high_traffic", event.Rule)
+	require.Equal(t, AlertStatusOpen, event.Status)
+
+	// Stats are sent on each push
+
+	pusher := stream.StatsPusher()
+	require.NoError(t, pusher.Push(mon.Stats(10*time.Second, 10), mon.Last(), 10*time.Second))
+
+	name, data = readEvent(t, reader)
+	require.Equal(t, "stats", name)
+	stats := &StatsResponse{}
+	require.NoError(t, json.Unmarshal([]byte(data), stats))
+	require.Equal(t, 3, stats.Count)
+	require.Equal(t, "/api", stats.TopSections[0].Key)
+
+	// Closing the stream ends the response
+
+	mon.Close()
+	_, err = reader.ReadString('\n')
+	require.Error(t, err)
+	require.NoError(t, pusher.Close())
+	stream.Close()
+	require.Equal(t, int64(0), stream.Dropped())
+}
+
+func TestStream_SlowClient(t *testing.T) {
+	stream := NewStream()
+	client := make(chan *streamEvent, streamClientQueueSize)
+	stream.clients[client] = struct{}{}
+
+	for i := 0; i < streamClientQueueSize+5; i++ {
+		stream.Notify(&Alert{Rule: "high_traffic", Start: start})
+	}
+	require.Len(t, client, streamClientQueueSize)
+	require.Equal(t, int64(5), stream.Dropped())
+
+	// No client can connect once closed
+
+	stream.Close()
+	recorder := httptest.NewRecorder()
+	stream.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/stream", nil))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
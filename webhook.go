@@ -0,0 +1,128 @@
+package accessmon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WebhookConfig holds the parameters of a WebhookNotifier
+type WebhookConfig struct {
+	URLs      []string      // URLs to POST the alert events to
+	QueueSize int           // Maximum number of pending events, new events are dropped when full ( 100 by default )
+	Retries   int           // Number of retries after a failed delivery
+	Backoff   time.Duration // Delay before the first retry, doubled on each retry ( 1s by default )
+	Timeout   time.Duration // HTTP request timeout ( 10s by default )
+}
+
+// Default WebhookConfig parameters
+const (
+	defaultWebhookQueueSize = 100
+	defaultWebhookBackoff   = time.Second
+	defaultWebhookTimeout   = 10 * time.Second
+)
+
+// WebhookNotifier POSTs a JSON AlertEvent to webhook URLs when alerts start or end
+// Events are delivered by a background goroutine from a bounded queue so that
+// a slow receiver never blocks the line processing
+type WebhookNotifier struct {
+	failed int64 // number of deliveries that failed after all retries ( first for 64-bit atomic alignment )
+
+	*asyncNotifier
+
+	config *WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookNotifier builds a WebhookNotifier and starts its delivery goroutine
+func NewWebhookNotifier(config *WebhookConfig) (notifier *WebhookNotifier) {
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultWebhookQueueSize
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultWebhookBackoff
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultWebhookTimeout
+	}
+
+	notifier = &WebhookNotifier{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+	notifier.asyncNotifier = newAsyncNotifier(config.QueueSize, 0, notifier.send)
+
+	return notifier
+}
+
+// Failed returns the number of deliveries that failed after all retries
+func (notifier *WebhookNotifier) Failed() int {
+	return int(atomic.LoadInt64(&notifier.failed))
+}
+
+// send delivers the events to every URL
+func (notifier *WebhookNotifier) send(events []*AlertEvent) {
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			atomic.AddInt64(&notifier.failed, 1)
+			continue
+		}
+		for _, url := range notifier.config.URLs {
+			if notifier.deliver(url, body) != nil {
+				atomic.AddInt64(&notifier.failed, 1)
+			}
+		}
+	}
+}
+
+// deliver POSTs the body to the url retrying with an exponential backoff
+func (notifier *WebhookNotifier) deliver(url string, body []byte) (err error) {
+	backoff := notifier.config.Backoff
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = notifier.post(url, body)
+		if err == nil || !retry || attempt >= notifier.config.Retries {
+			return err
+		}
+
+		// Stop retrying when the notifier is closed and out of time
+
+		select {
+		case <-time.After(backoff):
+		case <-notifier.ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a single request, it returns whether a failed delivery is worth retrying
+func (notifier *WebhookNotifier) post(url string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := notifier.client.Do(req.WithContext(notifier.ctx))
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	// Client errors other than rate limiting won't get better by retrying
+
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook %s : unexpected status %s", url, resp.Status)
+}
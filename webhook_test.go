@@ -0,0 +1,145 @@
+package accessmon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	var lock sync.Mutex
+	var events []*AlertEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := &AlertEvent{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(event))
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(&WebhookConfig{URLs: []string{server.URL, server.URL}})
+
+	alert := &Alert{Rule: "high_traffic", Severity: "critical", Metric: MetricRequestRate, Start: start, Value: 12.5}
+	notifier.Notify(alert)
+	alert.End = start.Add(time.Minute)
+	notifier.Notify(alert)
+	notifier.Close()
+
+	require.Len(t, events, 4)
+	require.Equal(t, "high_traffic", events[0].Rule)
+	require.Equal(t, "critical", events[0].Severity)
+	require.Equal(t, AlertStatusOpen, events[0].Status)
+	require.True(t, start.Equal(events[0].Start))
+	require.Nil(t, events[0].End)
+	require.Equal(t, 12.5, events[0].Value)
+	require.Equal(t, hostname(), events[0].Host)
+
+	require.Equal(t, AlertStatusClosed, events[3].Status)
+	require.True(t, start.Add(time.Minute).Equal(*events[3].End))
+	require.Equal(t, float64(60), events[3].Duration)
+
+	require.Equal(t, 0, notifier.Failed())
+	require.Equal(t, 0, notifier.Dropped())
+}
+
+func TestWebhookNotifier_Retry(t *testing.T) {
+	var lock sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(&WebhookConfig{URLs: []string{server.URL}, Retries: 2, Backoff: time.Millisecond})
+	notifier.Notify(&Alert{Rule: "high_traffic", Start: start})
+	notifier.Close()
+
+	require.Equal(t, 3, calls)
+	require.Equal(t, 0, notifier.Failed())
+}
+
+func TestWebhookNotifier_NoRetry(t *testing.T) {
+	var lock sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(&WebhookConfig{URLs: []string{server.URL}, Retries: 2, Backoff: time.Millisecond})
+	notifier.Notify(&Alert{Rule: "high_traffic", Start: start})
+	notifier.Close()
+
+	require.Equal(t, 1, calls)
+	require.Equal(t, 1, notifier.Failed())
+}
+
+func TestWebhookNotifier_CloseTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(&WebhookConfig{URLs: []string{server.URL}, Retries: 10, Backoff: time.Minute})
+	notifier.closeTimeout = 100 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		notifier.Notify(&Alert{Rule: "high_traffic", Start: start})
+	}
+
+	// The backoff is interrupted and the pending events dropped
+
+	closed := time.Now()
+	notifier.Close()
+	require.True(t, time.Since(closed) < 5*time.Second)
+
+	require.Equal(t, 1, notifier.Failed())
+	require.Equal(t, 2, notifier.Dropped())
+}
+
+func TestWebhookNotifier_QueueFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(&WebhookConfig{URLs: []string{server.URL}, QueueSize: 2})
+
+	// The slow receiver must not block Notify
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			notifier.Notify(&Alert{Rule: "high_traffic", Start: start})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify did block")
+	}
+
+	close(release)
+	notifier.Close()
+
+	// One event in flight at most and two in the queue
+
+	require.True(t, notifier.Dropped() >= 7)
+}